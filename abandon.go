@@ -0,0 +1,63 @@
+// File contains Abandon functionality
+//
+// https://tools.ietf.org/html/rfc4511
+//
+// AbandonRequest ::= [APPLICATION 16] MessageID
+//
+
+package ldap
+
+import (
+	"errors"
+	"sort"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// Abandon asks the server to stop processing the operation with the given
+// message ID. The server does not respond to an abandon request, so the
+// caller waiting for the operation on this connection is released
+// immediately with an *Error whose result code is ErrorCanceled.
+//
+// Abandon is safe to call from another goroutine than the one running the
+// operation. Use PendingMessageIDs to find the message IDs in flight.
+func (l *Conn) Abandon(messageID int64) error {
+	l.messageMutex.Lock()
+	if msg, ok := l.messageContexts[messageID]; ok {
+		msg.abandon()
+	}
+	l.messageMutex.Unlock()
+
+	abandonID := l.nextMessageID()
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, abandonID, "MessageID"))
+	packet.AppendChild(ber.NewInteger(ber.ClassApplication, ber.TypePrimitive, ApplicationAbandonRequest, messageID, "Abandon Request"))
+
+	l.Debug.PrintPacket(packet)
+
+	channel, err := l.sendMessage(packet)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return NewError(ErrorNetwork, errors.New("ldap: could not send message"))
+	}
+	l.finishMessage(abandonID)
+	return nil
+}
+
+// PendingMessageIDs returns the message IDs of the operations that are
+// currently waiting for a response on this connection, in ascending order.
+func (l *Conn) PendingMessageIDs() []int64 {
+	l.messageMutex.Lock()
+	ids := make([]int64, 0, len(l.messageContexts))
+	for messageID, msg := range l.messageContexts {
+		if !msg.closed {
+			ids = append(ids, messageID)
+		}
+	}
+	l.messageMutex.Unlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -5,6 +5,7 @@
 package ldap
 
 import (
+	"context"
 	"errors"
 
 	"gopkg.in/asn1-ber.v1"
@@ -20,6 +21,13 @@ type SimpleBindResult struct {
 	Controls []Control
 }
 
+// PasswordPolicy returns the password policy status reported by the
+// server with the bind response, or nil if it did not send any. Ask for it
+// by adding NewControlBeheraPasswordPolicy() to the request controls.
+func (r *SimpleBindResult) PasswordPolicy() *PasswordPolicyStatus {
+	return passwordPolicyStatus(r.Controls)
+}
+
 func NewSimpleBindRequest(username string, password string, controls []Control) *SimpleBindRequest {
 	return &SimpleBindRequest{
 		Username: username,
@@ -34,52 +42,25 @@ func (bindRequest *SimpleBindRequest) encode() *ber.Packet {
 	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, bindRequest.Username, "User Name"))
 	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, bindRequest.Password, "Password"))
 
-	request.AppendChild(encodeControls(bindRequest.Controls))
-
 	return request
 }
 
+// SimpleBind performs a simple bind. The response controls, such as the
+// password policy controls, are returned whether the bind succeeded or not.
 func (l *Conn) SimpleBind(simpleBindRequest *SimpleBindRequest) (*SimpleBindResult, error) {
-	messageID := l.nextMessageID()
-
-	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
-	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
-	encodedBindRequest := simpleBindRequest.encode()
-	packet.AppendChild(encodedBindRequest)
-
-	if l.Debug {
-		ber.PrintPacket(packet)
-	}
+	return l.SimpleBindContext(context.Background(), simpleBindRequest)
+}
 
-	channel, err := l.sendMessage(packet)
+// SimpleBindContext is like SimpleBind, but gives up waiting for the
+// response and abandons the request when ctx is done.
+func (l *Conn) SimpleBindContext(ctx context.Context, simpleBindRequest *SimpleBindRequest) (*SimpleBindResult, error) {
+	packet, err := l.bindPacket(ctx, simpleBindRequest.encode(), simpleBindRequest.Controls)
 	if err != nil {
 		return nil, err
 	}
-	if channel == nil {
-		return nil, NewError(ErrorNetwork, errors.New("ldap: could not send message"))
-	}
-	defer l.finishMessage(messageID)
-
-	packet = <-channel
-	if packet == nil {
-		return nil, NewError(ErrorNetwork, errors.New("ldap: could not retrieve response"))
-	}
-
-	if l.Debug {
-		if err := addLDAPDescriptions(packet); err != nil {
-			return nil, err
-		}
-		ber.PrintPacket(packet)
-	}
 
 	result := &SimpleBindResult{
-		Controls: make([]Control, 0),
-	}
-
-	if len(packet.Children) == 3 {
-		for _, child := range packet.Children[2].Children {
-			result.Controls = append(result.Controls, DecodeControl(child))
-		}
+		Controls: decodePacketControls(packet),
 	}
 
 	resultCode, resultDescription := getLDAPResultCode(packet)
@@ -90,46 +71,102 @@ func (l *Conn) SimpleBind(simpleBindRequest *SimpleBindRequest) (*SimpleBindResu
 	return result, nil
 }
 
+// Bind performs a simple bind without controls. Use BindWithPolicy to
+// read the password policy status, or SimpleBind to send other controls
+// and to read the response controls.
 func (l *Conn) Bind(username, password string) error {
-	messageID := l.nextMessageID()
-
-	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
-	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
-	bindRequest := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationBindRequest, nil, "Bind Request")
-	bindRequest.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
-	bindRequest.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, username, "User Name"))
-	bindRequest.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, password, "Password"))
-	packet.AppendChild(bindRequest)
-
-	if l.Debug {
-		ber.PrintPacket(packet)
+	return l.BindContext(context.Background(), username, password)
+}
+
+// BindContext is like Bind, but gives up waiting for the response and
+// abandons the request when ctx is done.
+func (l *Conn) BindContext(ctx context.Context, username, password string) error {
+	_, err := l.SimpleBindContext(ctx, NewSimpleBindRequest(username, password, nil))
+	return err
+}
+
+// BindWithPolicy is like Bind, but requests the password policy status
+// with NewControlBeheraPasswordPolicy and returns it whether the bind
+// succeeded or not. The status is nil if the server did not report one.
+func (l *Conn) BindWithPolicy(username, password string) (*PasswordPolicyStatus, error) {
+	return l.BindWithPolicyContext(context.Background(), username, password)
+}
+
+// BindWithPolicyContext is like BindWithPolicy, but gives up waiting for
+// the response and abandons the request when ctx is done.
+func (l *Conn) BindWithPolicyContext(ctx context.Context, username, password string) (*PasswordPolicyStatus, error) {
+	result, err := l.SimpleBindContext(ctx, NewSimpleBindRequest(username, password, []Control{NewControlBeheraPasswordPolicy()}))
+	if result == nil {
+		return nil, err
 	}
+	return result.PasswordPolicy(), err
+}
 
-	channel, err := l.sendMessage(packet)
-	if err != nil {
-		return err
+// PasswordPolicyStatus is the state of the password of the bound user, as
+// reported by the Behera password policy control and the older Netscape
+// password expired and expiring controls.
+type PasswordPolicyStatus struct {
+	// Expired is true if the password has expired. A bind that succeeds
+	// with an expired password used up one of the grace logins.
+	Expired bool
+	// Locked is true if the account is locked.
+	Locked bool
+	// MustChange is true if the password must be changed before any other
+	// operation, e.g. because it was reset by an administrator.
+	MustChange bool
+	// SecondsBeforeExpiration is the time left until the password expires,
+	// or -1 if the server did not report it.
+	SecondsBeforeExpiration int64
+	// GraceLoginsRemaining is the number of grace logins left after this
+	// one, or -1 if the server did not report it.
+	GraceLoginsRemaining int64
+	// Error is the Behera error (BeheraPasswordExpired, ...), or -1 if the
+	// server did not report one.
+	Error int8
+	// ErrorString describes Error.
+	ErrorString string
+}
+
+func passwordPolicyStatus(controls []Control) *PasswordPolicyStatus {
+	status := &PasswordPolicyStatus{
+		SecondsBeforeExpiration: -1,
+		GraceLoginsRemaining:    -1,
+		Error:                   -1,
 	}
-	if channel == nil {
-		return NewError(ErrorNetwork, errors.New("ldap: could not send message"))
+	found := false
+
+	if control, ok := FindControl(controls, ControlTypeBeheraPasswordPolicy).(*ControlBeheraPasswordPolicy); ok {
+		found = true
+		status.SecondsBeforeExpiration = control.Expire
+		status.GraceLoginsRemaining = control.Grace
+		status.Error = control.Error
+		status.ErrorString = control.ErrorString
+		switch control.Error {
+		case BeheraPasswordExpired:
+			status.Expired = true
+		case BeheraAccountLocked:
+			status.Locked = true
+		case BeheraChangeAfterReset:
+			status.MustChange = true
+		}
+		// Grace logins are only granted once the password has expired
+		if control.Grace >= 0 {
+			status.Expired = true
+		}
 	}
-	defer l.finishMessage(messageID)
-
-	packet = <-channel
-	if packet == nil {
-		return NewError(ErrorNetwork, errors.New("ldap: could not retrieve response"))
+	if control, ok := FindControl(controls, ControlTypeVChuPasswordMustChange).(*ControlVChuPasswordMustChange); ok {
+		found = true
+		status.MustChange = status.MustChange || control.MustChange
 	}
-
-	if l.Debug {
-		if err := addLDAPDescriptions(packet); err != nil {
-			return err
+	if control, ok := FindControl(controls, ControlTypeVChuPasswordWarning).(*ControlVChuPasswordWarning); ok {
+		found = true
+		if status.SecondsBeforeExpiration < 0 {
+			status.SecondsBeforeExpiration = control.Expire
 		}
-		ber.PrintPacket(packet)
 	}
 
-	resultCode, resultDescription := getLDAPResultCode(packet)
-	if resultCode != 0 {
-		return NewError(resultCode, errors.New(resultDescription))
+	if !found {
+		return nil
 	}
-
-	return nil
+	return status
 }
@@ -0,0 +1,94 @@
+// This file contains the cancel extended operation as specified in rfc 3909
+//
+// https://tools.ietf.org/html/rfc3909
+//
+// cancelRequestValue ::= SEQUENCE {
+//      cancelID        MessageID
+//                      -- MessageID is as defined in [RFC2251]
+// }
+//
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+const (
+	cancelOID = "1.3.6.1.1.8"
+)
+
+func encodeCancelRequest(messageID int64) *ber.Packet {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationExtendedRequest, nil, "Cancel Extended Operation")
+	request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, cancelOID, "Extended Request Name: Cancel OID"))
+	extendedRequestValue := ber.Encode(ber.ClassContext, ber.TypePrimitive, 1, nil, "Extended Request Value: Cancel Request")
+	cancelRequestValue := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Cancel Request")
+	cancelRequestValue.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Cancel ID"))
+	extendedRequestValue.AppendChild(cancelRequestValue)
+	request.AppendChild(extendedRequestValue)
+	return request
+}
+
+// Cancel asks the server to cancel the operation with the given message ID.
+// Unlike Abandon, the server answers both requests: the canceled operation
+// completes with LDAPResultCanceled, which is what the goroutine waiting for
+// it receives, and Cancel returns once the server has acknowledged the
+// cancellation. If the operation could not be canceled, Cancel returns an
+// *Error with LDAPResultNoSuchOperation, LDAPResultTooLate or
+// LDAPResultCannotCancel.
+func (l *Conn) Cancel(messageID int64) error {
+	return l.CancelContext(context.Background(), messageID)
+}
+
+// CancelContext is like Cancel, but gives up waiting for the response and
+// abandons the cancel request when ctx is done.
+func (l *Conn) CancelContext(ctx context.Context, messageID int64) error {
+	cancelID := l.nextMessageID()
+
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, cancelID, "MessageID"))
+	packet.AppendChild(encodeCancelRequest(messageID))
+
+	l.Debug.PrintPacket(packet)
+
+	channel, err := l.sendMessage(packet)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return NewError(ErrorNetwork, errors.New("ldap: could not send message"))
+	}
+	defer l.finishMessage(cancelID)
+
+	l.Debug.Printf("%d: waiting for response", cancelID)
+	packet, err = l.readPacket(ctx, cancelID, channel)
+	if err != nil {
+		return err
+	}
+	l.Debug.Printf("%d: got response %p", cancelID, packet)
+	if packet == nil {
+		return NewError(ErrorNetwork, errors.New("ldap: could not retrieve message"))
+	}
+
+	if l.Debug {
+		if err := addLDAPDescriptions(packet); err != nil {
+			return err
+		}
+		ber.PrintPacket(packet)
+	}
+
+	if packet.Children[1].Tag == ApplicationExtendedResponse {
+		resultCode, resultDescription := getLDAPResultCode(packet)
+		if resultCode != 0 {
+			return NewError(resultCode, errors.New(resultDescription))
+		}
+	} else {
+		return NewError(ErrorUnexpectedResponse, fmt.Errorf("Unexpected Response: %d", packet.Children[1].Tag))
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+func TestCancel(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	searchDone := make(chan error)
+	go func() {
+		_, err := l.Search(NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+		searchDone <- err
+	}()
+	search := <-requests
+	searchID := search.Children[0].Value.(int64)
+
+	cancelDone := make(chan error)
+	go func() {
+		cancelDone <- l.Cancel(searchID)
+	}()
+	request := <-requests
+	cancel := request.Children[1]
+	if cancel.Tag != ApplicationExtendedRequest || len(cancel.Children) != 2 {
+		t.Fatalf("expected an extended request, got tag %d", cancel.Tag)
+	}
+	if oid := string(cancel.Children[0].Data.Bytes()); oid != cancelOID {
+		t.Errorf("got request name %q, expected %q", oid, cancelOID)
+	}
+	value := ber.DecodePacket(cancel.Children[1].Data.Bytes())
+	if id, _ := ber.ParseInt64(value.Children[0].Data.Bytes()); id != searchID {
+		t.Errorf("got cancelID %d, expected %d", id, searchID)
+	}
+
+	// The canceled search completes first, Cancel only with its own response
+	writeResponse(t, server, searchID, newResult(ApplicationSearchResultDone, LDAPResultCanceled, ""))
+	if err := <-searchDone; !IsErrorWithCode(err, LDAPResultCanceled) {
+		t.Fatalf("expected LDAPResultCanceled for the search, got %v", err)
+	}
+	select {
+	case err := <-cancelDone:
+		t.Fatalf("Cancel returned %v before the server answered it", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationExtendedResponse, LDAPResultSuccess, ""))
+	if err := <-cancelDone; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCancelNoSuchOperation(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	done := make(chan error)
+	go func() {
+		done <- l.Cancel(42)
+	}()
+	request := <-requests
+	select {
+	case err := <-done:
+		t.Fatalf("Cancel returned %v before the server answered it", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationExtendedResponse, LDAPResultNoSuchOperation, "unknown message"))
+	if err := <-done; !IsErrorWithCode(err, LDAPResultNoSuchOperation) {
+		t.Fatalf("expected LDAPResultNoSuchOperation, got %v", err)
+	}
+}
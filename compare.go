@@ -20,10 +20,13 @@
 //
 // AttributeValue ::= OCTET STRING
 //
+// AssertionValue ::= OCTET STRING
+//
 
 package ldap
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -33,6 +36,12 @@ import (
 // Compare checks to see if the attribute of the dn matches value. Returns true if it does otherwise
 // false with any error that occurs if any.
 func (l *Conn) Compare(dn, attribute, value string) (bool, error) {
+	return l.CompareContext(context.Background(), dn, attribute, value)
+}
+
+// CompareContext is like Compare, but gives up waiting for the response and
+// abandons the request when ctx is done.
+func (l *Conn) CompareContext(ctx context.Context, dn, attribute, value string) (bool, error) {
 	messageID := l.nextMessageID()
 	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
 	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
@@ -42,7 +51,7 @@ func (l *Conn) Compare(dn, attribute, value string) (bool, error) {
 
 	ava := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "AttributeValueAssertion")
 	ava.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attribute, "AttributeDesc"))
-	ava.AppendChild(ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagOctetString, value, "AssertionValue"))
+	ava.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "AssertionValue"))
 	request.AppendChild(ava)
 	packet.AppendChild(request)
 
@@ -58,7 +67,10 @@ func (l *Conn) Compare(dn, attribute, value string) (bool, error) {
 	defer l.finishMessage(messageID)
 
 	l.Debug.Printf("%d: waiting for response", messageID)
-	packet = <-channel
+	packet, err = l.readPacket(ctx, messageID, channel)
+	if err != nil {
+		return false, err
+	}
 	l.Debug.Printf("%d: got response %p", messageID, packet)
 	if packet == nil {
 		return false, NewError(ErrorNetwork, errors.New("ldap: could not retrieve message"))
@@ -78,7 +90,7 @@ func (l *Conn) Compare(dn, attribute, value string) (bool, error) {
 		} else if resultCode == LDAPResultCompareFalse {
 			return false, nil
 		} else {
-			return false, NewError(resultCode, errors.New(resultDescription))
+			return false, newResultError(packet, resultCode, resultDescription)
 		}
 	}
 	return false, fmt.Errorf("Unexpected Response: %d", packet.Children[1].Tag)
@@ -0,0 +1,49 @@
+package ldap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+func TestCompareRequestEncoding(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	done := make(chan error)
+	var matched bool
+	go func() {
+		var err error
+		matched, err = l.Compare("cn=test,dc=example,dc=com", "cn", "test")
+		done <- err
+	}()
+	var request *ber.Packet
+	select {
+	case request = <-requests:
+	case <-time.After(5 * time.Second):
+	}
+	if request == nil {
+		t.Fatal("could not decode the compare request")
+	}
+
+	// The assertion value is a primitive OCTET STRING
+	want := []byte{0x6e, 0x27,
+		0x04, 0x19}
+	want = append(want, "cn=test,dc=example,dc=com"...)
+	want = append(want, 0x30, 0x0a, 0x04, 0x02, 'c', 'n', 0x04, 0x04, 't', 'e', 's', 't')
+	if got := request.Children[1].Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("got compare request\n%x\nexpected\n%x", got, want)
+	}
+
+	writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationCompareResponse, LDAPResultCompareTrue, ""))
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !matched {
+		t.Error("expected the compare to match")
+	}
+}
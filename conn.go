@@ -5,16 +5,21 @@
 package ldap
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"gopkg.in/asn1-ber.v1"
 	"log"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Deprecated: the Message* constants were used by the former message
+// dispatcher and have no meaning anymore.
 const (
 	MessageQuit     = 0
 	MessageRequest  = 1
@@ -22,11 +27,40 @@ const (
 	MessageFinish   = 3
 )
 
-type messagePacket struct {
-	Op        int
-	MessageID int64
-	Packet    *ber.Packet
-	Channel   chan *ber.Packet
+// DefaultQueueSize is the number of responses buffered for each request
+// before they spill over, if DialWithQueueSize is not used.
+const DefaultQueueSize = 64
+
+// messageContext tracks an outstanding request.
+type messageContext struct {
+	// responses buffers the responses until the caller reads them
+	responses chan *ber.Packet
+	// overflow holds the responses that did not fit in responses, in order.
+	// While it is not empty, a drainOverflow goroutine feeds it to responses
+	overflow []*ber.Packet
+	// done is closed once the request is finished or abandoned, responses
+	// arriving after that are dropped
+	done      chan struct{}
+	closed    bool
+	abandoned bool
+	deadline  time.Time
+}
+
+// abandon marks the request as abandoned. Conn.messageMutex must be held.
+func (m *messageContext) abandon() {
+	if !m.closed {
+		m.abandoned = true
+		m.closed = true
+		close(m.done)
+	}
+}
+
+// finish marks the request as finished. Conn.messageMutex must be held.
+func (m *messageContext) finish() {
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
 }
 
 type sendMessageFlags uint
@@ -37,111 +71,332 @@ const (
 
 // Conn represents an LDAP Connection
 type Conn struct {
+	// accessed atomically, first in the struct for 64-bit alignment
+	lastMessageID int64
+	binds         uint64
+
 	conn                net.Conn
 	isTLS               bool
-	isClosing           bool
+	isClosing           uint32
 	isStartingTLS       bool
 	Debug               debugging
-	chanConfirm         chan bool
-	chanResults         map[int64]chan *ber.Packet
-	chanMessage         chan *messagePacket
-	chanMessageID       chan int64
-	wgSender            sync.WaitGroup
-	wgClose             sync.WaitGroup
-	once                sync.Once
+	closed              chan struct{}
+	closeOnce           sync.Once
+	err                 error
+	wgReader            sync.WaitGroup
+	writeMutex          sync.Mutex
 	outstandingRequests uint
 	messageMutex        sync.Mutex
-
-	entryCallback   func(entry *Entry, controls []Control) error
-	cookieCallback  func([]byte) error
-	referalCallback func(string) error
+	messageContexts     map[int64]*messageContext
+	queueSize           int
+	requestTimeout      time.Duration
+	notificationHandler func(*UnsolicitedNotification)
+	notifications       chan *UnsolicitedNotification
+	notifyOnce          sync.Once
+	url                 string // of the server if dialed with DialURL
 }
 
 // DefaultTimeout is a package-level variable that sets the timeout value
-// used for the Dial and DialTLS methods.
+// used for the Dial and DialTLS methods if no DialOpt sets one.
 //
 // WARNING: since this is a package-level variable, setting this value from
-// multiple places will probably result in undesired behaviour.
+// multiple places will probably result in undesired behaviour. Use
+// DialWithTimeout instead.
 var DefaultTimeout = 60 * time.Second
 
+const (
+	// DefaultLdapPort is the port used by DialURL for ldap:// URLs
+	DefaultLdapPort = "389"
+	// DefaultLdapsPort is the port used by DialURL for ldaps:// URLs
+	DefaultLdapsPort = "636"
+	// DefaultLdapiSocket is the socket used by DialURL for ldapi:// URLs
+	// without a path
+	DefaultLdapiSocket = "/var/run/ldapi"
+)
+
+// DialOpt configures Dial, DialTLS, DialURL and NewConn. Options that only
+// apply to dialing are ignored by NewConn.
+type DialOpt func(*dialConfig)
+
+type dialConfig struct {
+	dialer              *net.Dialer
+	tlsConfig           *tls.Config
+	timeout             time.Duration
+	keepAlive           time.Duration
+	requestTimeout      time.Duration
+	queueSize           int
+	notificationHandler func(*UnsolicitedNotification)
+	debug               bool
+}
+
+// DialWithDialer sets the net.Dialer used to connect, e.g. to set a
+// source address or a proxy. By default a net.Dialer with DefaultTimeout
+// is used.
+func DialWithDialer(d *net.Dialer) DialOpt {
+	return func(dc *dialConfig) {
+		dc.dialer = d
+	}
+}
+
+// DialWithTLSConfig sets the TLS configuration for DialTLS, if it is called
+// with a nil config, and for ldaps:// URLs. By default only ServerName is
+// set, to the host dialed.
+func DialWithTLSConfig(tc *tls.Config) DialOpt {
+	return func(dc *dialConfig) {
+		dc.tlsConfig = tc
+	}
+}
+
+// DialWithTimeout sets the timeout for establishing the connection,
+// including the TLS handshake. It overrides the timeout of the dialer.
+func DialWithTimeout(d time.Duration) DialOpt {
+	return func(dc *dialConfig) {
+		dc.timeout = d
+	}
+}
+
+// DialWithKeepAlive sets the period of TCP keep-alive probes. A negative
+// period disables them. It overrides the keep-alive of the dialer.
+func DialWithKeepAlive(d time.Duration) DialOpt {
+	return func(dc *dialConfig) {
+		dc.keepAlive = d
+	}
+}
+
+// DialWithRequestTimeout sets how long operations wait for the server to
+// complete a request when their context has no earlier deadline. Requests
+// that time out are abandoned and fail with ErrorCanceled.
+func DialWithRequestTimeout(d time.Duration) DialOpt {
+	return func(dc *dialConfig) {
+		dc.requestTimeout = d
+	}
+}
+
+// DialWithQueueSize sets the number of responses buffered for each
+// request, DefaultQueueSize by default. Responses arriving while the buffer
+// of a request is full spill over and are held until the caller reads
+// them, so a caller that does not keep up never holds up the other
+// requests on the connection; see SearchResponse.
+func DialWithQueueSize(n int) DialOpt {
+	return func(dc *dialConfig) {
+		dc.queueSize = n
+	}
+}
+
+// DialWithDebug enables debug output for the connection.
+func DialWithDebug(enabled bool) DialOpt {
+	return func(dc *dialConfig) {
+		dc.debug = enabled
+	}
+}
+
+func newDialConfig(opts []DialOpt) *dialConfig {
+	dc := &dialConfig{}
+	for _, opt := range opts {
+		opt(dc)
+	}
+	return dc
+}
+
+// netDialer returns a copy of the configured dialer with the timeout and
+// keep-alive options applied.
+func (dc *dialConfig) netDialer() *net.Dialer {
+	d := &net.Dialer{Timeout: DefaultTimeout}
+	if dc.dialer != nil {
+		copied := *dc.dialer
+		d = &copied
+	}
+	if dc.timeout != 0 {
+		d.Timeout = dc.timeout
+	}
+	if dc.keepAlive != 0 {
+		d.KeepAlive = dc.keepAlive
+	}
+	return d
+}
+
 // Dial connects to the given address on the given network using net.Dial
 // and then returns a new Conn for the connection.
-func Dial(network, addr string) (*Conn, error) {
-	c, err := net.DialTimeout(network, addr, DefaultTimeout)
+func Dial(network, addr string, opts ...DialOpt) (*Conn, error) {
+	dc := newDialConfig(opts)
+	c, err := dc.netDialer().Dial(network, addr)
 	if err != nil {
 		return nil, NewError(ErrorNetwork, err)
 	}
-	conn := NewConn(c, false)
+	conn := NewConn(c, false, opts...)
 	conn.Start()
 	return conn, nil
 }
 
 // DialTLS connects to the given address on the given network using tls.Dial
 // and then returns a new Conn for the connection.
-func DialTLS(network, addr string, config *tls.Config) (*Conn, error) {
-	dc, err := net.DialTimeout(network, addr, DefaultTimeout)
+func DialTLS(network, addr string, config *tls.Config, opts ...DialOpt) (*Conn, error) {
+	dc := newDialConfig(opts)
+	if config == nil {
+		config = dc.tlsConfig
+	}
+	c, err := tls.DialWithDialer(dc.netDialer(), network, addr, config)
 	if err != nil {
 		return nil, NewError(ErrorNetwork, err)
 	}
-	c := tls.Client(dc, config)
-	err = c.Handshake()
+	conn := NewConn(c, true, opts...)
+	conn.Start()
+	return conn, nil
+}
+
+// DialURL connects to the server given by an ldap://, ldaps:// or ldapi://
+// URL and returns a new Conn for the connection. Ports default to 389 for
+// ldap:// and 636 for ldaps://. The host of an ldapi:// URL is the
+// percent-encoded path of a Unix socket, e.g.
+// "ldapi://%2Fvar%2Frun%2Fslapd%2Fldapi". The URL is parsed with
+// ParseLDAPURL, anything after the host is ignored.
+func DialURL(addr string, opts ...DialOpt) (*Conn, error) {
+	dc := newDialConfig(opts)
+	u, err := ParseLDAPURL(addr)
 	if err != nil {
-		// Handshake error, close the established connection before we return an error
-		dc.Close()
 		return nil, NewError(ErrorNetwork, err)
 	}
-	conn := NewConn(c, true)
-	conn.Start()
+
+	var conn *Conn
+	host := u.Host
+	switch u.Scheme {
+	case "ldapi":
+		if host == "" {
+			host = DefaultLdapiSocket
+		}
+		conn, err = Dial("unix", host, opts...)
+	case "ldap":
+		conn, err = Dial("tcp", withDefaultPort(host, DefaultLdapPort), opts...)
+	case "ldaps":
+		tlsConfig := &tls.Config{}
+		if dc.tlsConfig != nil {
+			tlsConfig = dc.tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = strings.Trim(hostWithoutPort(host), "[]")
+		}
+		conn, err = DialTLS("tcp", withDefaultPort(host, DefaultLdapsPort), tlsConfig, opts...)
+	default:
+		return nil, NewError(ErrorNetwork, fmt.Errorf("ldap: unsupported URL scheme %q", u.Scheme))
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.url = serverURL(&LDAPURL{Scheme: u.Scheme, Host: host})
 	return conn, nil
 }
 
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
 // NewConn returns a new Conn using conn for network I/O.
-func NewConn(conn net.Conn, isTLS bool) *Conn {
+func NewConn(conn net.Conn, isTLS bool, opts ...DialOpt) *Conn {
+	dc := newDialConfig(opts)
+	queueSize := dc.queueSize
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
 	return &Conn{
-		conn:          conn,
-		chanConfirm:   make(chan bool),
-		chanMessageID: make(chan int64),
-		chanMessage:   make(chan *messagePacket, 10),
-		chanResults:   map[int64]chan *ber.Packet{},
-		isTLS:         isTLS,
+		conn:                conn,
+		closed:              make(chan struct{}),
+		messageContexts:     map[int64]*messageContext{},
+		queueSize:           queueSize,
+		requestTimeout:      dc.requestTimeout,
+		notificationHandler: dc.notificationHandler,
+		isTLS:               isTLS,
+		Debug:               debugging(dc.debug),
 	}
 }
 
+// Start starts reading responses from the connection.
 func (l *Conn) Start() {
+	l.wgReader.Add(1)
 	go l.reader()
-	go l.processMessages()
-	l.wgClose.Add(1)
 }
 
-// Close closes the connection.
+// Close closes the connection. Pending and further operations fail with
+// the error returned by Err.
 func (l *Conn) Close() {
-	l.once.Do(func() {
-		l.isClosing = true
-		l.wgSender.Wait()
+	l.close(nil)
+	l.wgReader.Wait()
+}
 
-		l.Debug.Printf("Sending quit message and waiting for confirmation")
-		l.chanMessage <- &messagePacket{Op: MessageQuit}
-		<-l.chanConfirm
-		close(l.chanMessage)
+// Err returns nil while the connection is usable. Once the connection is
+// closed, it returns the error pending and further operations fail with:
+// an *Error with the ErrorNetwork result code wrapping the network or
+// decoding error the connection failed with, or a "connection closed"
+// error after Close.
+func (l *Conn) Err() error {
+	select {
+	case <-l.closed:
+		return l.err
+	default:
+		return nil
+	}
+}
 
-		l.Debug.Printf("Closing network connection")
-		if err := l.conn.Close(); err != nil {
-			log.Print(err)
+// Done returns a channel that is closed when the connection is closed,
+// either by Close or because it failed. Err returns the reason afterwards.
+func (l *Conn) Done() <-chan struct{} {
+	return l.closed
+}
+
+// close marks the connection as closing with err as the terminal error,
+// wakes up all pending operations and closes the network connection, which
+// stops the reader. Only the first call has an effect, it may be made from
+// the reader.
+func (l *Conn) close(err error) {
+	l.closeOnce.Do(func() {
+		if err == nil {
+			err = errors.New("ldap: connection closed")
+		} else {
+			l.Debug.Printf("Closing connection: %s", err.Error())
+		}
+		if _, ok := err.(*Error); !ok {
+			err = NewError(ErrorNetwork, err)
 		}
+		// l.err is read after l.closed is closed
+		l.err = err
+		close(l.closed)
+		atomic.StoreUint32(&l.isClosing, 1)
+
+		l.messageMutex.Lock()
+		conn := l.conn
+		l.messageMutex.Unlock()
 
-		l.wgClose.Done()
+		l.Debug.Printf("Closing network connection")
+		if err := conn.Close(); err != nil {
+			l.Debug.Printf("Error closing network connection: %s", err.Error())
+		}
 	})
-	l.wgClose.Wait()
+}
+
+// IsClosing returns true once the connection is being closed, either by
+// Close or because the reader failed on a network or decoding error. A
+// closing connection cannot be used anymore.
+func (l *Conn) IsClosing() bool {
+	return atomic.LoadUint32(&l.isClosing) == 1
+}
+
+// bindCount returns the number of bind requests sent on the connection.
+func (l *Conn) bindCount() uint64 {
+	return atomic.LoadUint64(&l.binds)
 }
 
 // Returns the next available messageID
 func (l *Conn) nextMessageID() int64 {
-	if l.chanMessageID != nil {
-		if messageID, ok := <-l.chanMessageID; ok {
-			return messageID
-		}
-	}
-	return 0
+	return atomic.AddInt64(&l.lastMessageID, 1)
 }
 
 // StartTLS sends the command to start a TLS session and then creates a new TLS Client
@@ -168,9 +423,12 @@ func (l *Conn) StartTLS(config *tls.Config) error {
 	}
 
 	l.Debug.Printf("%d: waiting for response", messageID)
-	packet = <-channel
-	l.Debug.Printf("%d: got response %p", messageID, packet)
+	packet, err = l.readPacket(context.Background(), messageID, channel)
 	l.finishMessage(messageID)
+	if err != nil {
+		return err
+	}
+	l.Debug.Printf("%d: got response %p", messageID, packet)
 
 	if l.Debug {
 		if err := addLDAPDescriptions(packet); err != nil {
@@ -181,27 +439,32 @@ func (l *Conn) StartTLS(config *tls.Config) error {
 	}
 
 	status, ok := getValueFromPacket(packet)
-	if !ok {
-		return fmt.Errorf("ldap: received unexpected response while starting TLS")
-	}
-
-	if status == LDAPResultSuccess {
-		conn := tls.Client(l.conn, config)
-
-		if err := conn.Handshake(); err != nil {
-			l.Close()
-			return NewError(ErrorNetwork, fmt.Errorf("TLS handshake failed (%v)", err))
+	if !ok || status != LDAPResultSuccess {
+		// The reader stopped after the response, continue without TLS
+		l.wgReader.Add(1)
+		go l.reader()
+		if !ok {
+			return fmt.Errorf("ldap: received unexpected response while starting TLS")
 		}
-
-		l.isTLS = true
-		l.conn = conn
-	} else {
 		// https://tools.ietf.org/html/rfc4511#section-4.1.9
 		// Children[1].Children[2] is the diagnosticMessage which is guaranteed to exist.
 		return NewError(
-			uint8(status),
+			uint16(status),
 			fmt.Errorf("ldap: cannot StartTLS (%s)", packet.Children[1].Children[2].Value.(string)))
 	}
+
+	conn := tls.Client(l.conn, config)
+	if err := conn.Handshake(); err != nil {
+		l.Close()
+		return NewError(ErrorNetwork, fmt.Errorf("TLS handshake failed (%v)", err))
+	}
+
+	l.messageMutex.Lock()
+	l.isTLS = true
+	l.conn = conn
+	l.messageMutex.Unlock()
+
+	l.wgReader.Add(1)
 	go l.reader()
 
 	return nil
@@ -224,16 +487,65 @@ func getValueFromPacket(p *ber.Packet) (int64, bool) {
 	return v, ok
 }
 
+// readPacket waits for the next response packet for messageID. If ctx is
+// done first, the operation is abandoned on the server and ctx.Err() is
+// returned wrapped in an *Error with the ErrorCanceled result code. The
+// request timeout of the connection, if any, is applied to ctx. The same
+// result code is returned when the operation is abandoned from another
+// goroutine with Abandon. Once the connection is closed, an *Error with
+// the ErrorNetwork result code is returned.
+func (l *Conn) readPacket(ctx context.Context, messageID int64, channel chan *ber.Packet) (*ber.Packet, error) {
+	l.messageMutex.Lock()
+	msg := l.messageContexts[messageID]
+	l.messageMutex.Unlock()
+	if msg == nil {
+		return nil, NewError(ErrorNetwork, fmt.Errorf("ldap: message %d is not pending", messageID))
+	}
+
+	if !msg.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, msg.deadline)
+		defer cancel()
+	}
+
+	select {
+	case packet := <-channel:
+		return packet, nil
+	case <-msg.done:
+		l.Debug.Printf("%d: abandoned", messageID)
+		return nil, NewError(ErrorCanceled, errors.New("ldap: operation abandoned"))
+	case <-ctx.Done():
+		l.Debug.Printf("%d: abandoning (%v)", messageID, ctx.Err())
+		if err := l.Abandon(messageID); err != nil {
+			l.Debug.Printf("%d: could not abandon: %s", messageID, err.Error())
+		}
+		return nil, NewError(ErrorCanceled, ctx.Err())
+	case <-l.closed:
+		// Responses read before the connection was closed are still
+		// delivered
+		select {
+		case packet := <-channel:
+			return packet, nil
+		default:
+		}
+		return nil, l.err
+	}
+}
+
 func (l *Conn) sendMessage(packet *ber.Packet) (chan *ber.Packet, error) {
 	return l.sendMessageWithFlags(packet, 0)
 }
 
+// sendMessageWithFlags registers a request and writes it to the
+// connection. The request must be finished with finishMessage, unless an
+// error is returned.
 func (l *Conn) sendMessageWithFlags(packet *ber.Packet, flags sendMessageFlags) (chan *ber.Packet, error) {
-	if l.isClosing {
-		return nil, NewError(ErrorNetwork, errors.New("ldap: connection closed"))
+	if err := l.Err(); err != nil {
+		return nil, err
 	}
+	messageID := packet.Children[0].Value.(int64)
+
 	l.messageMutex.Lock()
-	l.Debug.Printf("flags&startTLS = %d", flags&startTLS)
 	if l.isStartingTLS {
 		l.messageMutex.Unlock()
 		return nil, NewError(ErrorNetwork, errors.New("ldap: connection is in startls phase."))
@@ -242,133 +554,86 @@ func (l *Conn) sendMessageWithFlags(packet *ber.Packet, flags sendMessageFlags)
 		if l.outstandingRequests != 0 {
 			l.messageMutex.Unlock()
 			return nil, NewError(ErrorNetwork, errors.New("ldap: cannot StartTLS with outstanding requests"))
-		} else {
-			l.isStartingTLS = true
 		}
+		l.isStartingTLS = true
+	}
+	msg := &messageContext{
+		responses: make(chan *ber.Packet, l.queueSize),
+		done:      make(chan struct{}),
+	}
+	if l.requestTimeout > 0 {
+		msg.deadline = time.Now().Add(l.requestTimeout)
 	}
+	l.messageContexts[messageID] = msg
 	l.outstandingRequests++
-
+	conn := l.conn
 	l.messageMutex.Unlock()
 
-	out := make(chan *ber.Packet)
-	message := &messagePacket{
-		Op:        MessageRequest,
-		MessageID: packet.Children[0].Value.(int64),
-		Packet:    packet,
-		Channel:   out,
+	l.Debug.Printf("Sending message %d", messageID)
+	l.writeMutex.Lock()
+	_, err := conn.Write(packet.Bytes())
+	l.writeMutex.Unlock()
+	if err != nil {
+		l.Debug.Printf("Error Sending Message: %s", err.Error())
+		l.finishMessage(messageID)
+		// A partially written request leaves the connection unusable
+		l.close(err)
+		return nil, l.Err()
 	}
-	l.sendProcessMessage(message)
-	return out, nil
+	return msg.responses, nil
 }
 
+// finishMessage unregisters a request. Responses still arriving for it are
+// dropped.
 func (l *Conn) finishMessage(messageID int64) {
-	if l.isClosing {
-		return
-	}
-
 	l.messageMutex.Lock()
-	l.outstandingRequests--
-	if l.isStartingTLS {
-		l.isStartingTLS = false
-	}
-	l.messageMutex.Unlock()
-
-	message := &messagePacket{
-		Op:        MessageFinish,
-		MessageID: messageID,
-	}
-	l.sendProcessMessage(message)
-}
+	defer l.messageMutex.Unlock()
 
-func (l *Conn) sendProcessMessage(message *messagePacket) bool {
-	if l.isClosing {
-		return false
+	if msg, ok := l.messageContexts[messageID]; ok {
+		l.Debug.Printf("Finished message %d", messageID)
+		delete(l.messageContexts, messageID)
+		l.outstandingRequests--
+		msg.finish()
 	}
-	l.wgSender.Add(1)
-	l.chanMessage <- message
-	l.wgSender.Done()
-	return true
-}
-
-func (l *Conn) processMessages() {
-	defer func() {
-		if err := recover(); err != nil {
-			log.Printf("ldap: recovered panic in processMessages: %v", err)
-		}
-		for messageID, channel := range l.chanResults {
-			l.Debug.Printf("Closing channel for MessageID %d", messageID)
-			close(channel)
-			delete(l.chanResults, messageID)
-		}
-		close(l.chanMessageID)
-		l.chanConfirm <- true
-		close(l.chanConfirm)
-	}()
-
-	var messageID int64 = 1
-	for {
-		select {
-		case l.chanMessageID <- messageID:
-			messageID++
-		case messagePacket, ok := <-l.chanMessage:
-			if !ok {
-				l.Debug.Printf("Shutting down - message channel is closed")
-				return
-			}
-			switch messagePacket.Op {
-			case MessageQuit:
-				l.Debug.Printf("Shutting down - quit message received")
-				return
-			case MessageRequest:
-				// Add to message list and write to network
-				l.Debug.Printf("Sending message %d", messagePacket.MessageID)
-				l.chanResults[messagePacket.MessageID] = messagePacket.Channel
-				// go routine
-				buf := messagePacket.Packet.Bytes()
-
-				_, err := l.conn.Write(buf)
-				if err != nil {
-					l.Debug.Printf("Error Sending Message: %s", err.Error())
-					break
-				}
-			case MessageResponse:
-				l.Debug.Printf("Receiving message %d", messagePacket.MessageID)
-				if chanResult, ok := l.chanResults[messagePacket.MessageID]; ok {
-					chanResult <- messagePacket.Packet
-				} else {
-					log.Printf("Received unexpected message %d", messagePacket.MessageID)
-					ber.PrintPacket(messagePacket.Packet)
-				}
-			case MessageFinish:
-				// Remove from message list
-				l.Debug.Printf("Finished message %d", messagePacket.MessageID)
-				close(l.chanResults[messagePacket.MessageID])
-				delete(l.chanResults, messagePacket.MessageID)
-			}
-		}
+	if l.isStartingTLS {
+		l.isStartingTLS = false
 	}
 }
 
+// reader reads responses from the connection and queues each for the
+// request it belongs to, without waiting for the caller to read it. The
+// reader runs until the
+// connection fails or is closed, the server sends a notice of
+// disconnection, or StartTLS takes the connection over.
 func (l *Conn) reader() {
+	defer l.wgReader.Done()
+
 	cleanstop := false
+	var err error
 	defer func() {
-		if err := recover(); err != nil {
-			log.Printf("ldap: recovered panic in reader: %v", err)
+		if r := recover(); r != nil {
+			log.Printf("ldap: recovered panic in reader: %v", r)
+			err = fmt.Errorf("ldap: recovered panic in reader: %v", r)
 		}
 		if !cleanstop {
-			l.Close()
+			l.close(err)
 		}
 	}()
 
+	l.messageMutex.Lock()
+	conn := l.conn
+	l.messageMutex.Unlock()
+
 	for {
 		if cleanstop {
 			l.Debug.Printf("reader clean stopping (without closing the connection)")
 			return
 		}
-		packet, err := ber.ReadPacket(l.conn)
+		var packet *ber.Packet
+		packet, err = ber.ReadPacket(conn)
 		if err != nil {
 			// A read error is expected here if we are closing the connection...
-			if !l.isClosing {
+			if !l.IsClosing() {
 				l.Debug.Printf("reader error: %s", err.Error())
 			}
 			return
@@ -378,19 +643,83 @@ func (l *Conn) reader() {
 			l.Debug.Printf("Received bad ldap packet")
 			continue
 		}
+		messageID, ok := packet.Children[0].Value.(int64)
+		if !ok {
+			l.Debug.Printf("Received ldap packet without message ID")
+			continue
+		}
+		if messageID == 0 {
+			if err = l.handleUnsolicited(packet); err != nil {
+				return
+			}
+			continue
+		}
+
 		l.messageMutex.Lock()
+		msg := l.messageContexts[messageID]
 		if l.isStartingTLS {
 			cleanstop = true
 		}
 		l.messageMutex.Unlock()
-		message := &messagePacket{
-			Op:        MessageResponse,
-			MessageID: packet.Children[0].Value.(int64),
-			Packet:    packet,
+
+		if msg == nil {
+			l.Debug.Printf("Received unexpected message %d", messageID)
+			l.Debug.PrintPacket(packet)
+			continue
 		}
-		if !l.sendProcessMessage(message) {
+		l.queue(messageID, msg, packet)
+	}
+}
+
+// queue hands packet to the caller of the request msg without blocking. A
+// packet that does not fit in msg.responses is added to msg.overflow, and
+// the first one starts a goroutine feeding the overflow to the caller.
+func (l *Conn) queue(messageID int64, msg *messageContext, packet *ber.Packet) {
+	l.messageMutex.Lock()
+	defer l.messageMutex.Unlock()
+
+	if msg.closed {
+		l.Debug.Printf("Dropped response to finished message %d", messageID)
+		return
+	}
+	if len(msg.overflow) == 0 {
+		select {
+		case msg.responses <- packet:
+			return
+		default:
+		}
+	}
+	msg.overflow = append(msg.overflow, packet)
+	if len(msg.overflow) == 1 {
+		go l.drainOverflow(msg)
+	}
+}
+
+// drainOverflow feeds msg.overflow to msg.responses until it is empty, the
+// request is finished or abandoned, or the connection is closed.
+func (l *Conn) drainOverflow(msg *messageContext) {
+	for {
+		l.messageMutex.Lock()
+		packet := msg.overflow[0]
+		l.messageMutex.Unlock()
+
+		select {
+		case msg.responses <- packet:
+		case <-msg.done:
+			l.messageMutex.Lock()
+			msg.overflow = nil
+			l.messageMutex.Unlock()
+			return
+		case <-l.closed:
 			return
 		}
 
+		l.messageMutex.Lock()
+		msg.overflow = msg.overflow[1:]
+		empty := len(msg.overflow) == 0
+		l.messageMutex.Unlock()
+		if empty {
+			return
+		}
 	}
 }
@@ -0,0 +1,628 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// newPipeConn returns a started Conn talking to the server end of an
+// in-memory pipe.
+func newPipeConn() (*Conn, net.Conn) {
+	client, server := net.Pipe()
+	l := NewConn(client, false)
+	l.Start()
+	return l, server
+}
+
+// readRequests decodes the packets the client writes to server.
+func readRequests(server net.Conn) <-chan *ber.Packet {
+	requests := make(chan *ber.Packet)
+	go func() {
+		defer close(requests)
+		for {
+			packet, err := ber.ReadPacket(server)
+			if err != nil {
+				return
+			}
+			requests <- packet
+		}
+	}()
+	return requests
+}
+
+// writeResponse sends an LDAP message with the given protocol operation
+// and controls from the server end of the pipe.
+func writeResponse(t *testing.T, server net.Conn, messageID int64, op *ber.Packet, controls ...Control) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(op)
+	if len(controls) > 0 {
+		packet.AppendChild(encodeControls(controls))
+	}
+	if _, err := server.Write(packet.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newResult encodes an LDAPResult based protocol operation.
+func newResult(tag ber.Tag, resultCode int, diagnostic string) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, ApplicationMap[uint8(tag)])
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, resultCode, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, diagnostic, "Diagnostic Message"))
+	return result
+}
+
+// newSearchEntry encodes a search result entry with a single attribute.
+func newSearchEntry(dn, attribute string, values ...string) *ber.Packet {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "Object Name"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	attributes.AppendChild((&PartialAttribute{Type: attribute, Vals: values}).encode())
+	entry.AppendChild(attributes)
+	return entry
+}
+
+func TestSearchContextAbandon(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		_, err := l.SearchContext(ctx, NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+		done <- err
+	}()
+
+	search := <-requests
+	if search.Children[1].Tag != ApplicationSearchRequest {
+		t.Fatalf("expected a search request, got tag %d", search.Children[1].Tag)
+	}
+
+	abandon := <-requests
+	if abandon.Children[1].Tag != ApplicationAbandonRequest {
+		t.Fatalf("expected an abandon request, got tag %d", abandon.Children[1].Tag)
+	}
+	if id, _ := ber.ParseInt64(abandon.Children[1].Data.Bytes()); id != search.Children[0].Value.(int64) {
+		t.Errorf("abandoned message %d, expected %d", id, search.Children[0].Value.(int64))
+	}
+
+	err := <-done
+	e, ok := err.(*Error)
+	if !ok || e.ResultCode != ErrorCanceled {
+		t.Fatalf("expected ErrorCanceled, got %v", err)
+	}
+	if e.Err != context.DeadlineExceeded {
+		t.Errorf("expected the context error to be wrapped, got %v", e.Err)
+	}
+}
+
+func TestAbandonFromOtherGoroutine(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	done := make(chan error)
+	go func() {
+		_, err := l.Search(NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+		done <- err
+	}()
+
+	search := <-requests
+	pending := l.PendingMessageIDs()
+	if len(pending) != 1 || pending[0] != search.Children[0].Value.(int64) {
+		t.Fatalf("unexpected pending message IDs %v", pending)
+	}
+
+	go l.Abandon(pending[0])
+	if abandon := <-requests; abandon.Children[1].Tag != ApplicationAbandonRequest {
+		t.Fatalf("expected an abandon request, got tag %d", abandon.Children[1].Tag)
+	}
+
+	if err := <-done; !IsErrorWithCode(err, ErrorCanceled) {
+		t.Fatalf("expected ErrorCanceled, got %v", err)
+	}
+}
+
+func TestSearchAsync(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	response := l.SearchAsync(context.Background(), NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+	defer response.Close()
+	messageID := (<-requests).Children[0].Value.(int64)
+
+	go func() {
+		writeResponse(t, server, messageID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"))
+		// A reference without URIs is skipped
+		empty := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationSearchResultReference, nil, "Search Result Reference")
+		writeResponse(t, server, messageID, empty)
+		reference := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationSearchResultReference, nil, "Search Result Reference")
+		reference.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "ldap://other.example.com/dc=example,dc=com", "URI"))
+		reference.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "ldap://backup.example.com/dc=example,dc=com", "URI"))
+		writeResponse(t, server, messageID, reference)
+		writeResponse(t, server, messageID, newSearchEntry("cn=b,dc=example,dc=com", "cn", "b"))
+		writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+	}()
+
+	var got []string
+	for response.Next() {
+		if entry := response.Entry(); entry != nil {
+			got = append(got, entry.GetAttributeValue("cn"))
+		} else if referrals := response.Referrals(); referrals != nil {
+			if response.Referral() != referrals[0] {
+				t.Errorf("Referral returned %q, expected the first of %q", response.Referral(), referrals)
+			}
+			got = append(got, referrals...)
+		}
+	}
+	if err := response.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "ldap://other.example.com/dc=example,dc=com", "ldap://backup.example.com/dc=example,dc=com", "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
+
+func TestPagedSearch(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	searchRequest := NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil)
+	paged := l.PagedSearch(context.Background(), searchRequest, 1)
+	defer paged.Close()
+
+	go func() {
+		for i, cookie := range []string{"page2", ""} {
+			request := <-requests
+			paging := FindControl(decodePacketControls(request), ControlTypePaging).(*ControlPaging)
+			if i == 1 && string(paging.Cookie) != "page2" {
+				t.Errorf("expected cookie %q, got %q", "page2", paging.Cookie)
+			}
+			messageID := request.Children[0].Value.(int64)
+			writeResponse(t, server, messageID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"))
+			writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""),
+				&ControlPaging{PagingSize: 2, Cookie: []byte(cookie)})
+		}
+	}()
+
+	pages := 0
+	for paged.Next() {
+		pages++
+		if len(paged.Page().Entries) != 1 {
+			t.Errorf("page %d: expected 1 entry, got %d", pages, len(paged.Page().Entries))
+		}
+		if paged.EstimatedSize() != 2 {
+			t.Errorf("page %d: expected an estimated size of 2, got %d", pages, paged.EstimatedSize())
+		}
+	}
+	if err := paged.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if pages != 2 {
+		t.Errorf("expected 2 pages, got %d", pages)
+	}
+	if searchRequest.Controls != nil {
+		t.Errorf("the search request was modified: %v", searchRequest.Controls)
+	}
+}
+
+func TestPagedSearchCloseAfterCancel(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	searchRequest := NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil)
+	paged := l.PagedSearch(ctx, searchRequest, 1)
+
+	// The second page is never answered, only the request to discard it
+	discarded := make(chan string, 1)
+	go func() {
+		for request := range requests {
+			if request.Children[1].Tag != ApplicationSearchRequest {
+				continue
+			}
+			messageID := request.Children[0].Value.(int64)
+			paging := FindControl(decodePacketControls(request), ControlTypePaging).(*ControlPaging)
+			switch {
+			case len(paging.Cookie) == 0:
+				writeResponse(t, server, messageID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"))
+				writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""),
+					&ControlPaging{Cookie: []byte("page2")})
+			case paging.PagingSize == 0:
+				discarded <- string(paging.Cookie)
+				writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+			}
+		}
+	}()
+
+	if !paged.Next() {
+		t.Fatal(paged.Err())
+	}
+	cancel()
+	if paged.Next() || !IsErrorWithCode(paged.Err(), ErrorCanceled) {
+		t.Fatalf("expected ErrorCanceled, got %v", paged.Err())
+	}
+	if err := paged.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case cookie := <-discarded:
+		if cookie != "page2" {
+			t.Errorf("discarded cookie %q, expected page2", cookie)
+		}
+	default:
+		t.Error("Close did not tell the server to discard the remaining pages")
+	}
+}
+
+func TestSimpleBindPasswordPolicy(t *testing.T) {
+	testcases := []struct {
+		resultCode int
+		value      []byte
+		expected   PasswordPolicyStatus
+	}{
+		// error: passwordExpired
+		{LDAPResultInvalidCredentials, []byte{0x30, 0x03, 0x81, 0x01, 0x00},
+			PasswordPolicyStatus{Expired: true, SecondsBeforeExpiration: -1, GraceLoginsRemaining: -1, Error: BeheraPasswordExpired, ErrorString: "Password expired"}},
+		// error: accountLocked
+		{LDAPResultInvalidCredentials, []byte{0x30, 0x03, 0x81, 0x01, 0x01},
+			PasswordPolicyStatus{Locked: true, SecondsBeforeExpiration: -1, GraceLoginsRemaining: -1, Error: BeheraAccountLocked, ErrorString: "Account locked"}},
+		// warning: graceAuthNsRemaining 3
+		{LDAPResultSuccess, []byte{0x30, 0x05, 0xa0, 0x03, 0x81, 0x01, 0x03},
+			PasswordPolicyStatus{Expired: true, SecondsBeforeExpiration: -1, GraceLoginsRemaining: 3, Error: -1}},
+		// warning: timeBeforeExpiration 300, error: changeAfterReset
+		{LDAPResultSuccess, []byte{0x30, 0x09, 0xa0, 0x04, 0x80, 0x02, 0x01, 0x2c, 0x81, 0x01, 0x02},
+			PasswordPolicyStatus{MustChange: true, SecondsBeforeExpiration: 300, GraceLoginsRemaining: -1, Error: BeheraChangeAfterReset, ErrorString: "Password must be changed"}},
+	}
+
+	binds := map[string]func(l *Conn) (*PasswordPolicyStatus, error){
+		"SimpleBind": func(l *Conn) (*PasswordPolicyStatus, error) {
+			result, err := l.SimpleBind(NewSimpleBindRequest("cn=user,dc=example,dc=com", "password", []Control{NewControlBeheraPasswordPolicy()}))
+			if result == nil {
+				return nil, err
+			}
+			return result.PasswordPolicy(), err
+		},
+		"BindWithPolicy": func(l *Conn) (*PasswordPolicyStatus, error) {
+			return l.BindWithPolicy("cn=user,dc=example,dc=com", "password")
+		},
+	}
+
+	for name, bind := range binds {
+		for i, testcase := range testcases {
+			testcase := testcase
+			l, server := newPipeConn()
+			requests := readRequests(server)
+
+			go func() {
+				request := <-requests
+				if FindControl(decodePacketControls(request), ControlTypeBeheraPasswordPolicy) == nil {
+					t.Errorf("%s %d: the password policy control was not requested", name, i)
+				}
+				writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationBindResponse, testcase.resultCode, ""),
+					NewControlString(ControlTypeBeheraPasswordPolicy, false, string(testcase.value)))
+			}()
+
+			status, err := bind(l)
+			if testcase.resultCode != LDAPResultSuccess && !IsErrorWithCode(err, uint16(testcase.resultCode)) {
+				t.Errorf("%s %d: expected result code %d, got %v", name, i, testcase.resultCode, err)
+			}
+			if status == nil {
+				t.Errorf("%s %d: no password policy status", name, i)
+			} else if *status != testcase.expected {
+				t.Errorf("%s %d: expected %+v, got %+v", name, i, testcase.expected, *status)
+			}
+			l.Close()
+			server.Close()
+		}
+	}
+}
+
+func TestDialURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "ldapi")
+	unixListener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unixListener.Close()
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpListener.Close()
+
+	for _, testcase := range []struct {
+		addr     string
+		listener net.Listener
+	}{
+		{"ldapi://" + url.PathEscape(socket), unixListener},
+		{"ldap://" + tcpListener.Addr().String(), tcpListener},
+	} {
+		accepted := make(chan net.Conn, 1)
+		go func(listener net.Listener) {
+			c, err := listener.Accept()
+			if err == nil {
+				accepted <- c
+			}
+			close(accepted)
+		}(testcase.listener)
+
+		l, err := DialURL(testcase.addr, DialWithDialer(&net.Dialer{Timeout: time.Second}))
+		if err != nil {
+			t.Errorf("%s: %v", testcase.addr, err)
+			continue
+		}
+		if c := <-accepted; c == nil {
+			t.Errorf("%s: no connection accepted", testcase.addr)
+		} else {
+			c.Close()
+		}
+		l.Close()
+	}
+
+	if _, err := DialURL("http://ldap.example.com"); !IsErrorWithCode(err, ErrorNetwork) {
+		t.Errorf("expected a network error for an http:// URL, got %v", err)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	l := NewConn(client, false, DialWithRequestTimeout(20*time.Millisecond), DialWithDebug(false))
+	l.Start()
+	defer l.Close()
+	requests := readRequests(server)
+
+	done := make(chan error)
+	go func() {
+		_, err := l.Compare("cn=test,dc=example,dc=com", "cn", "test")
+		done <- err
+	}()
+
+	compare := <-requests
+	select {
+	case err := <-done:
+		if !IsErrorWithCode(err, ErrorCanceled) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a canceled deadline error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request did not time out")
+	}
+
+	abandon := <-requests
+	if abandon.Children[1].Tag != ApplicationAbandonRequest {
+		t.Fatalf("expected an abandon request, got tag %d", abandon.Children[1].Tag)
+	}
+	if id, _ := ber.ParseInt64(abandon.Children[1].Data.Bytes()); id != compare.Children[0].Value.(int64) {
+		t.Errorf("abandoned message %d instead of %d", id, compare.Children[0].Value.(int64))
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		if c, err := listener.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+
+	dialer := &net.Dialer{}
+	l, err := Dial("tcp", listener.Addr().String(), DialWithDialer(dialer), DialWithTimeout(time.Second),
+		DialWithKeepAlive(-1), DialWithRequestTimeout(time.Minute), DialWithDebug(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if !l.Debug || l.requestTimeout != time.Minute {
+		t.Errorf("options not applied to the connection")
+	}
+	if dialer.Timeout != 0 || dialer.KeepAlive != 0 {
+		t.Errorf("options changed the caller's dialer")
+	}
+}
+
+func TestResponsesQueuedPerRequest(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	response := l.SearchAsync(context.Background(), NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+	defer response.Close()
+	searchID := (<-requests).Children[0].Value.(int64)
+
+	compared := make(chan error)
+	go func() {
+		_, err := l.Compare("cn=test,dc=example,dc=com", "cn", "test")
+		compared <- err
+	}()
+	compareID := (<-requests).Children[0].Value.(int64)
+
+	// The entries wait in the queue of the search without holding up the
+	// response to the compare.
+	writeResponse(t, server, searchID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"))
+	writeResponse(t, server, searchID, newSearchEntry("cn=b,dc=example,dc=com", "cn", "b"))
+	writeResponse(t, server, compareID, newResult(ApplicationCompareResponse, LDAPResultCompareTrue, ""))
+	select {
+	case err := <-compared:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("compare blocked by the unread search entries")
+	}
+
+	go func() {
+		writeResponse(t, server, searchID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+	}()
+	var got []string
+	for response.Next() {
+		got = append(got, response.Entry().DN)
+	}
+	if err := response.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cn=a,dc=example,dc=com", "cn=b,dc=example,dc=com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
+
+func TestFullQueueDoesNotBlockOtherRequests(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	l := NewConn(client, false, DialWithQueueSize(1))
+	l.Start()
+	defer l.Close()
+	requests := readRequests(server)
+
+	searchRequest := NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil)
+	response := l.SearchAsync(context.Background(), searchRequest)
+	defer response.Close()
+	asyncID := (<-requests).Children[0].Value.(int64)
+
+	// The entries fill the queue of the unread search and spill over
+	var want []string
+	for i := 0; i < 5; i++ {
+		dn := fmt.Sprintf("cn=%d,dc=example,dc=com", i)
+		writeResponse(t, server, asyncID, newSearchEntry(dn, "cn", "a"))
+		want = append(want, dn)
+	}
+
+	searched := make(chan error)
+	go func() {
+		_, err := l.Search(searchRequest)
+		searched <- err
+	}()
+	searchID := (<-requests).Children[0].Value.(int64)
+	writeResponse(t, server, searchID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+	select {
+	case err := <-searched:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("search blocked by the full queue of another search")
+	}
+
+	go func() {
+		writeResponse(t, server, asyncID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+	}()
+	var got []string
+	for response.Next() {
+		got = append(got, response.Entry().DN)
+	}
+	if err := response.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, expected %q", got, want)
+	}
+}
+
+func TestConnectionLossFailsPendingRequests(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	requests := readRequests(server)
+
+	const pending = 5
+	errs := make(chan error, pending)
+	for i := 0; i < pending; i++ {
+		go func() {
+			_, err := l.Compare("cn=test,dc=example,dc=com", "cn", "test")
+			errs <- err
+		}()
+	}
+	for i := 0; i < pending; i++ {
+		<-requests
+	}
+	if err := l.Err(); err != nil {
+		t.Fatalf("expected no error on an open connection, got %v", err)
+	}
+
+	server.Close()
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection not done after the connection was lost")
+	}
+	if err := l.Err(); !IsErrorWithCode(err, ErrorNetwork) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected a network error wrapping io.ErrUnexpectedEOF, got %v", err)
+	}
+	for i := 0; i < pending; i++ {
+		select {
+		case err := <-errs:
+			if err != l.Err() {
+				t.Errorf("expected the connection error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("pending request not failed after the connection was lost")
+		}
+	}
+
+	if !l.IsClosing() {
+		t.Error("connection not closing after the connection was lost")
+	}
+	if _, err := l.Compare("cn=test,dc=example,dc=com", "cn", "test"); err != l.Err() {
+		t.Errorf("expected the connection error on a closed connection, got %v", err)
+	}
+	if ids := l.PendingMessageIDs(); len(ids) != 0 {
+		t.Errorf("expected no pending messages, got %v", ids)
+	}
+}
+
+func TestConnErrAfterClose(t *testing.T) {
+	l, server := newPipeConn()
+	defer server.Close()
+	readRequests(server)
+
+	l.Close()
+	select {
+	case <-l.Done():
+	default:
+		t.Fatal("connection not done after Close")
+	}
+	err := l.Err()
+	if !IsErrorWithCode(err, ErrorNetwork) {
+		t.Fatalf("expected a network error after Close, got %v", err)
+	}
+	if _, cerr := l.Compare("cn=test,dc=example,dc=com", "cn", "test"); cerr != err {
+		t.Errorf("expected %v, got %v", err, cerr)
+	}
+}
@@ -1,16 +1,61 @@
 package ldap
 
 import (
+	"context"
 	"errors"
 	"fmt"
 )
 
+// Content synchronization modes -- RFC 4533
 const (
-	refreshOnly       = 1
-	refreshAndPersist = 3
+	ContentSyncRefreshOnly       = 1
+	ContentSyncRefreshAndPersist = 3
 )
 
+// ContentSyncResult is the result of a content synchronization that the
+// server ended, such as every refreshOnly synchronization.
+type ContentSyncResult struct {
+	// Cookie is the cookie to start the next synchronization with, taken
+	// from the Sync Done control or, if that has none, the last cookie
+	// received.
+	Cookie []byte
+
+	// RefreshDeletes is set if the refresh ended with a delete phase.
+	// Otherwise it ended with a present phase, and entries that were not
+	// reported as present have been deleted.
+	RefreshDeletes bool
+}
+
+// ContentSyncOptions holds the callbacks of ContentSync. Each of them may
+// be nil.
+type ContentSyncOptions struct {
+	// Entry receives every entry with its UUID and sync state.
+	Entry EntryCallback
+
+	// Event receives the changes as typed events. Entries listed by UUID
+	// in a syncIdSet Sync Info Message are passed as events without an
+	// entry.
+	Event SyncEventCallback
+
+	// Cookie receives every cookie, including those of Sync Info Messages.
+	Cookie CookieCallback
+
+	// SyncInfo receives the decoded Sync Info Messages. They tell when a
+	// refresh phase is done and which entries were deleted or are still
+	// present, see SyncInfo.
+	SyncInfo SyncInfoCallback
+}
+
+// GetContentSyncRequest returns a refreshAndPersist content
+// synchronization search request.
 func GetContentSyncRequest(baseDn, filter string, cookie []byte) *SearchRequest {
+	return GetContentSyncRequestWithMode(baseDn, filter, ContentSyncRefreshAndPersist, cookie)
+}
+
+// GetContentSyncRequestWithMode returns a content synchronization search
+// request in the given mode, ContentSyncRefreshOnly or
+// ContentSyncRefreshAndPersist.
+func GetContentSyncRequestWithMode(baseDn, filter string, mode uint64, cookie []byte) *SearchRequest {
 	sizeLimit := 0
 	timeLimit := 0
 	typesOnly := false
@@ -20,7 +65,7 @@ func GetContentSyncRequest(baseDn, filter string, cookie []byte) *SearchRequest
 		reloadHint = true
 	}
 
-	contentSyncControl := NewControlContentSync(refreshAndPersist, reloadHint, cookie)
+	contentSyncControl := NewControlContentSync(mode, reloadHint, cookie)
 
 	searchRequest := NewSearchRequest(
 		baseDn, ScopeWholeSubtree, NeverDerefAliases,
@@ -32,8 +77,84 @@ func GetContentSyncRequest(baseDn, filter string, cookie []byte) *SearchRequest
 	return searchRequest
 }
 
+// RunContentSync runs the content synchronization searchRequest until the
+// server ends it, passing the entries to entryCallback and the cookies to
+// cookieCallback. It is ContentSync without a context.
 func (l *Conn) RunContentSync(searchRequest *SearchRequest, entryCallback EntryCallback, cookieCallback CookieCallback) error {
-	l.entryCallback = func(entry *Entry, controls []Control) error {
+	_, err := l.ContentSync(context.Background(), searchRequest, ContentSyncOptions{Entry: entryCallback, Cookie: cookieCallback})
+	return err
+}
+
+// ContentSync runs a content synchronization, i.e. a search request from
+// GetContentSyncRequest or GetContentSyncRequestWithMode, and passes what
+// the server sends to the callbacks of options. A refreshAndPersist
+// synchronization runs until ctx is done, when the search is abandoned. A
+// refreshOnly synchronization ends once the server has sent the changes
+// since the cookie of the request, so synchronizations can run on a
+// schedule without holding a connection open; the cookie for the next run
+// is returned with the result.
+func (l *Conn) ContentSync(ctx context.Context, searchRequest *SearchRequest, options ContentSyncOptions) (*ContentSyncResult, error) {
+	if _, ok := FindControl(searchRequest.Controls, ControlTypeContentSync).(*ControlContentSync); !ok {
+		return nil, errors.New("ldap: no content sync control found")
+	}
+
+	result := &ContentSyncResult{}
+	searchResult, err := l.runContentSync(ctx, searchRequest,
+		func(entry *Entry, control *ControlContentSyncState) error {
+			if options.Entry != nil {
+				if err := options.Entry(entry, control.Uuid, control.State); err != nil {
+					return err
+				}
+			}
+			if options.Event != nil {
+				event, err := newSyncEvent(entry, control)
+				if err != nil {
+					return err
+				}
+				return options.Event(event)
+			}
+			return nil
+		},
+		func(cookie []byte) error {
+			result.Cookie = cookie
+			if options.Cookie != nil {
+				return options.Cookie(cookie)
+			}
+			return nil
+		},
+		func(info *SyncInfo) error {
+			if options.Event != nil {
+				events, err := syncInfoEvents(info)
+				if err != nil {
+					return err
+				}
+				for _, event := range events {
+					if err := options.Event(event); err != nil {
+						return err
+					}
+				}
+			}
+			if options.SyncInfo != nil {
+				return options.SyncInfo(info)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	if done, ok := FindControl(searchResult.Controls, ControlTypeContentSyncDone).(*ControlContentSyncDone); ok {
+		if done.Cookie != nil {
+			result.Cookie = done.Cookie
+		}
+		result.RefreshDeletes = done.RefreshDeletes
+	}
+	return result, nil
+}
+
+func (l *Conn) runContentSync(ctx context.Context, searchRequest *SearchRequest, entryCallback func(*Entry, *ControlContentSyncState) error, cookieCallback CookieCallback, syncInfoCallback SyncInfoCallback) (*SearchResult, error) {
+	var callbacks searchCallbacks
+	callbacks.entry = func(entry *Entry, controls []Control) error {
 
 		if len(controls) == 0 {
 			// FreeIPA sends duplicate objects in "compatability" mode.  These won't have any controls.
@@ -45,29 +166,33 @@ func (l *Conn) RunContentSync(searchRequest *SearchRequest, entryCallback EntryC
 			return err
 		}
 
-		if err := entryCallback(entry, control.Uuid, control.State); err != nil {
+		if err := entryCallback(entry, control); err != nil {
 			return err
 		}
 
 		// Update and Delete events come with the cookie, and a separate cookie message will not arrive
-		if control.Cookie != nil && len(control.Cookie) > 0 {
+		if control.Cookie != nil && len(control.Cookie) > 0 && cookieCallback != nil {
 			return cookieCallback(control.Cookie)
 		}
 
 		return nil
 	}
 
-	l.cookieCallback = func(cookie []byte) error {
+	callbacks.cookie = func(cookie []byte) error {
+		if cookieCallback == nil {
+			return nil
+		}
 		return cookieCallback(cookie)
 	}
 
-	l.referalCallback = func(referal string) error {
+	callbacks.referral = func(referals []string) error {
 		// TODO: what do we do with this?
 		return nil
 	}
 
-	_, err := l.Search(searchRequest)
-	return err
+	callbacks.syncInfo = syncInfoCallback
+
+	return l.searchWithCallbacks(ctx, searchRequest, callbacks)
 }
 
 func getContentSyncStateControl(controls []Control) (*ControlContentSyncState, error) {
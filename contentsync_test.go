@@ -0,0 +1,115 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContentSyncRefreshOnly(t *testing.T) {
+	tests := []struct {
+		name       string
+		done       *ControlContentSyncDone
+		wantCookie string
+	}{
+		{"done cookie", &ControlContentSyncDone{Cookie: []byte("c2"), RefreshDeletes: true}, "c2"},
+		{"no done cookie", &ControlContentSyncDone{}, "c1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, server := newPipeConn()
+			defer l.Close()
+			defer server.Close()
+			requests := readRequests(server)
+
+			var dns []string
+			done := make(chan error)
+			var result *ContentSyncResult
+			go func() {
+				var err error
+				result, err = l.ContentSync(context.Background(),
+					GetContentSyncRequestWithMode("dc=example,dc=com", "(objectClass=*)", ContentSyncRefreshOnly, []byte("c0")),
+					ContentSyncOptions{Entry: func(entry *Entry, uuid []byte, state uint32) error {
+						dns = append(dns, entry.DN)
+						return nil
+					}})
+				done <- err
+			}()
+			messageID := (<-requests).Children[0].Value.(int64)
+
+			writeResponse(t, server, messageID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"),
+				&ControlContentSyncState{State: EntryStateModify, Uuid: []byte("0123456789abcdef"), Cookie: []byte("c1")})
+			writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), test.done)
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			if len(dns) != 1 || dns[0] != "cn=a,dc=example,dc=com" {
+				t.Errorf("unexpected entries %q", dns)
+			}
+			if string(result.Cookie) != test.wantCookie {
+				t.Errorf("got cookie %q, expected %q", result.Cookie, test.wantCookie)
+			}
+			if result.RefreshDeletes != test.done.RefreshDeletes {
+				t.Errorf("got RefreshDeletes %v, expected %v", result.RefreshDeletes, test.done.RefreshDeletes)
+			}
+		})
+	}
+}
+
+func TestSearchAfterContentSyncRefresh(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	done := make(chan error)
+	go func() {
+		_, err := l.ContentSync(context.Background(),
+			GetContentSyncRequestWithMode("dc=example,dc=com", "(objectClass=*)", ContentSyncRefreshOnly, nil),
+			ContentSyncOptions{
+				Entry:    func(*Entry, []byte, uint32) error { return nil },
+				SyncInfo: func(*SyncInfo) error { return nil },
+			})
+		done <- err
+	}()
+	messageID := (<-requests).Children[0].Value.(int64)
+	writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), &ControlContentSyncDone{Cookie: []byte("c1")})
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// The callbacks of the synchronization must not receive the results
+	// of later searches on the connection
+	go func() {
+		request, ok := <-requests
+		if !ok {
+			return
+		}
+		messageID := request.Children[0].Value.(int64)
+		writeResponse(t, server, messageID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"))
+		writeResponse(t, server, messageID, newSyncInfoResponse(newSyncInfo(SyncInfoNewCookie, []byte("c2"))))
+		writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+	}()
+	result, err := l.Search(NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(cn=a)", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].DN != "cn=a,dc=example,dc=com" {
+		t.Errorf("unexpected entries %v", result.Entries)
+	}
+	if string(result.Cookie) != "c2" {
+		t.Errorf("got cookie %q, expected c2", result.Cookie)
+	}
+}
+
+func TestContentSyncWithoutControl(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+
+	_, err := l.ContentSync(context.Background(), NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil),
+		ContentSyncOptions{Entry: func(*Entry, []byte, uint32) error { return nil }})
+	if err == nil {
+		t.Fatal("expected an error for a search without the content sync control")
+	}
+}
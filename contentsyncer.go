@@ -0,0 +1,208 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Default reconnect backoff of a ContentSyncer
+const (
+	DefaultContentSyncBackoff    = time.Second
+	DefaultContentSyncMaxBackoff = time.Minute
+)
+
+// ContentSyncer keeps a refreshAndPersist content synchronization running.
+// It resumes from the cookie in its store and saves each cookie the server
+// sends once the changes before it were handled. When the connection
+// fails, it reconnects with exponential backoff and resumes from the last
+// saved cookie. When the server cannot resume from the cookie anymore
+// (LDAPResultSyncRefreshRequired), the cookie is dropped and all entries
+// are reloaded. If the server refuses the reload too, Run returns the
+// error.
+type ContentSyncer struct {
+	// Dial opens a bound connection to the server. It is called again
+	// after every failure.
+	Dial func(ctx context.Context) (*Conn, error)
+
+	// BaseDN, Filter and Attributes select the entries to synchronize.
+	// Filter defaults to (objectClass=*).
+	BaseDN     string
+	Filter     string
+	Attributes []string
+
+	// Store persists the cookie. If nil, the cookie is only kept in
+	// memory, so a restarted process reloads all entries.
+	Store CookieStore
+
+	// Handler receives the entries that were added, modified, deleted or
+	// are present. Entries listed by UUID in a Sync Info Message are
+	// passed without an entry. If it returns an error, Run stops and
+	// returns the error.
+	Handler SyncEventCallback
+
+	// SyncInfo, if set, receives the Sync Info Messages, e.g. to find the
+	// end of the refresh phase.
+	SyncInfo SyncInfoCallback
+
+	// Reload, if set, is called before all entries are reloaded. The
+	// entries are then sent again as added or present; entries that are
+	// not sent anymore were deleted.
+	Reload func() error
+
+	// Backoff is the time to wait before the first reconnect. It doubles
+	// with every further attempt without progress, up to MaxBackoff.
+	// DefaultContentSyncBackoff and DefaultContentSyncMaxBackoff are used
+	// if they are not set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Run synchronizes until ctx is done or the handler, a callback or the
+// store fails. Network errors and busy or unavailable servers lead to a
+// reconnect, other errors are returned.
+func (s *ContentSyncer) Run(ctx context.Context) error {
+	if s.Dial == nil || s.Handler == nil {
+		return errors.New("ldap: ContentSyncer needs Dial and Handler")
+	}
+	store := s.Store
+	if store == nil {
+		store = &memoryCookieStore{}
+	}
+
+	backoff := s.initialBackoff()
+	for {
+		cookie, err := store.Load()
+		if err != nil {
+			return err
+		}
+		if len(cookie) == 0 {
+			cookie = nil
+		}
+
+		progress, retry, err := s.sync(ctx, store, cookie)
+		switch {
+		case ctx.Err() != nil:
+			return NewError(ErrorCanceled, ctx.Err())
+		case IsErrorWithCode(err, LDAPResultSyncRefreshRequired):
+			if cookie == nil {
+				// Reloading cannot resolve it either
+				return err
+			}
+			if err := store.Save(nil); err != nil {
+				return err
+			}
+			if s.Reload != nil {
+				if err := s.Reload(); err != nil {
+					return err
+				}
+			}
+			backoff = s.initialBackoff()
+			continue
+		case !retry:
+			return err
+		}
+
+		if progress {
+			backoff = s.initialBackoff()
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return NewError(ErrorCanceled, ctx.Err())
+		}
+		backoff *= 2
+		if max := s.maxBackoff(); backoff > max {
+			backoff = max
+		}
+	}
+}
+
+// sync runs one synchronization search from cookie on a new connection.
+// progress reports whether any change was handled, retry whether err is
+// worth a reconnect.
+func (s *ContentSyncer) sync(ctx context.Context, store CookieStore, cookie []byte) (progress, retry bool, err error) {
+	conn, err := s.Dial(ctx)
+	if err != nil {
+		return false, isTransientSyncError(err), err
+	}
+	defer conn.Close()
+
+	filter := s.Filter
+	if filter == "" {
+		filter = "(objectClass=*)"
+	}
+	searchRequest := GetContentSyncRequest(s.BaseDN, filter, cookie)
+	searchRequest.Attributes = s.Attributes
+
+	// Errors of the handler, the callbacks and the store end Run
+	var stop error
+	_, err = conn.ContentSync(ctx, searchRequest, ContentSyncOptions{
+		Event: func(event *SyncEvent) error {
+			if stop = s.Handler(event); stop != nil {
+				return stop
+			}
+			progress = true
+			return nil
+		},
+		Cookie: func(cookie []byte) error {
+			if stop = store.Save(cookie); stop != nil {
+				return stop
+			}
+			progress = true
+			return nil
+		},
+		SyncInfo: func(info *SyncInfo) error {
+			if s.SyncInfo != nil {
+				if stop = s.SyncInfo(info); stop != nil {
+					return stop
+				}
+			}
+			progress = true
+			return nil
+		},
+	})
+	if stop != nil {
+		return progress, false, stop
+	}
+	if err == nil {
+		// The server ended the persist phase, resume on a new connection
+		return progress, true, NewError(ErrorNetwork, errors.New("ldap: content sync ended by the server"))
+	}
+	return progress, conn.Err() != nil || isTransientSyncError(err), err
+}
+
+func (s *ContentSyncer) initialBackoff() time.Duration {
+	if s.Backoff > 0 {
+		return s.Backoff
+	}
+	return DefaultContentSyncBackoff
+}
+
+func (s *ContentSyncer) maxBackoff() time.Duration {
+	if s.MaxBackoff > 0 {
+		return s.MaxBackoff
+	}
+	return DefaultContentSyncMaxBackoff
+}
+
+// isTransientSyncError returns true for errors a reconnect may resolve.
+func isTransientSyncError(err error) bool {
+	return IsErrorWithCode(err, ErrorNetwork) ||
+		IsErrorWithCode(err, LDAPResultBusy) ||
+		IsErrorWithCode(err, LDAPResultUnavailable)
+}
+
+// memoryCookieStore keeps the cookie in memory.
+type memoryCookieStore struct {
+	cookie []byte
+}
+
+func (s *memoryCookieStore) Load() ([]byte, error) {
+	return s.cookie, nil
+}
+
+func (s *memoryCookieStore) Save(cookie []byte) error {
+	s.cookie = cookie
+	return nil
+}
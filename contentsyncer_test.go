@@ -0,0 +1,216 @@
+package ldap
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// requestCookie returns the cookie of the content sync control of a
+// search request.
+func requestCookie(request *ber.Packet) string {
+	control := request.Children[2].Children[0]
+	value := ber.DecodePacket(control.Children[len(control.Children)-1].Data.Bytes())
+	return string(value.Children[1].Data.Bytes())
+}
+
+func TestFileCookieStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileCookieStore(filepath.Join(dir, "cookie"))
+
+	if cookie, err := store.Load(); err != nil || cookie != nil {
+		t.Fatalf("expected no cookie, got %q, %v", cookie, err)
+	}
+	for _, want := range []string{"c1", "c2"} {
+		if err := store.Save([]byte(want)); err != nil {
+			t.Fatal(err)
+		}
+		if cookie, err := store.Load(); err != nil || string(cookie) != want {
+			t.Fatalf("got %q, %v, expected %q", cookie, err, want)
+		}
+	}
+	if err := store.Save(nil); err != nil {
+		t.Fatal(err)
+	}
+	if cookie, err := store.Load(); err != nil || cookie != nil {
+		t.Fatalf("expected no cookie after removing it, got %q, %v", cookie, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("temporary files left behind: %v", files)
+	}
+}
+
+func TestContentSyncer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewFileCookieStore(filepath.Join(dir, "cookie"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var cookies, events []string
+	reloads := 0
+
+	// Each connection gets the next of these server scripts.
+	servers := []func(server net.Conn, request *ber.Packet){
+		// Sends an entry, then loses the connection
+		func(server net.Conn, request *ber.Packet) {
+			writeResponse(t, server, request.Children[0].Value.(int64), newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"),
+				&ControlContentSyncState{State: EntryStateAdd, Uuid: []byte("0123456789abcdef"), Cookie: []byte("c1")})
+			server.Close()
+		},
+		// Cannot resume from the cookie
+		func(server net.Conn, request *ber.Packet) {
+			writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationSearchResultDone, LDAPResultSyncRefreshRequired, ""))
+		},
+		// Reloads, reporting one entry as deleted
+		func(server net.Conn, request *ber.Packet) {
+			idSet := newSyncInfo(SyncInfoIDSet, nil)
+			idSet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, true, "Refresh Deletes"))
+			uuids := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Sync UUIDs")
+			uuids.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "0123456789abcdef", "UUID"))
+			idSet.AppendChild(uuids)
+			writeResponse(t, server, request.Children[0].Value.(int64), newSyncInfoResponse(idSet))
+			writeResponse(t, server, request.Children[0].Value.(int64), newSearchEntry("cn=b,dc=example,dc=com", "cn", "b"),
+				&ControlContentSyncState{State: EntryStateAdd, Uuid: []byte("fedcba9876543210"), Cookie: []byte("c2")})
+		},
+	}
+
+	dials := 0
+	syncer := &ContentSyncer{
+		Dial: func(ctx context.Context) (*Conn, error) {
+			if dials == len(servers) {
+				t.Error("too many connections")
+				return nil, NewError(LDAPResultOther, nil)
+			}
+			client, server := net.Pipe()
+			script := servers[dials]
+			dials++
+			go func() {
+				request, err := ber.ReadPacket(server)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				cookies = append(cookies, requestCookie(request))
+				mu.Unlock()
+				script(server, request)
+				// Keep the connection open until the client closes it
+				for {
+					if _, err := ber.ReadPacket(server); err != nil {
+						return
+					}
+				}
+			}()
+			l := NewConn(client, false)
+			l.Start()
+			return l, nil
+		},
+		BaseDN: "dc=example,dc=com",
+		Store:  store,
+		Handler: func(event *SyncEvent) error {
+			dn := ""
+			if event.Entry != nil {
+				dn = event.Entry.DN
+			}
+			mu.Lock()
+			events = append(events, dn+"/"+event.State.String()+"/"+string(event.UUID[:]))
+			mu.Unlock()
+			if dn == "cn=b,dc=example,dc=com" {
+				cancel()
+			}
+			return nil
+		},
+		Reload: func() error {
+			reloads++
+			return nil
+		},
+		Backoff: time.Millisecond,
+	}
+
+	if err := syncer.Run(ctx); !IsErrorWithCode(err, ErrorCanceled) {
+		t.Fatalf("expected ErrorCanceled, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"", "c1", ""}; !reflect.DeepEqual(cookies, want) {
+		t.Errorf("requested with cookies %q, expected %q", cookies, want)
+	}
+	want := []string{
+		"cn=a,dc=example,dc=com/add/0123456789abcdef",
+		"/delete/0123456789abcdef",
+		"cn=b,dc=example,dc=com/add/fedcba9876543210",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got events %q, expected %q", events, want)
+	}
+	if reloads != 1 {
+		t.Errorf("got %d reloads, expected 1", reloads)
+	}
+	if cookie, _ := store.Load(); string(cookie) != "c2" {
+		t.Errorf("stored cookie %q, expected c2", cookie)
+	}
+}
+
+func TestContentSyncerRefreshRequiredWithoutCookie(t *testing.T) {
+	store := &memoryCookieStore{cookie: []byte("c0")}
+	dials, reloads := 0, 0
+	syncer := &ContentSyncer{
+		Dial: func(ctx context.Context) (*Conn, error) {
+			dials++
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				request, err := ber.ReadPacket(server)
+				if err != nil {
+					return
+				}
+				writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationSearchResultDone, LDAPResultSyncRefreshRequired, ""))
+				ber.ReadPacket(server)
+			}()
+			l := NewConn(client, false)
+			l.Start()
+			return l, nil
+		},
+		BaseDN:  "dc=example,dc=com",
+		Store:   store,
+		Handler: func(*SyncEvent) error { return nil },
+		Reload: func() error {
+			reloads++
+			return nil
+		},
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- syncer.Run(context.Background())
+	}()
+	select {
+	case err := <-done:
+		if !IsErrorWithCode(err, LDAPResultSyncRefreshRequired) {
+			t.Fatalf("expected LDAPResultSyncRefreshRequired, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run kept retrying the refresh")
+	}
+	if dials != 2 || reloads != 1 {
+		t.Errorf("got %d connections and %d reloads, expected 2 and 1", dials, reloads)
+	}
+}
@@ -8,13 +8,6 @@ import (
 	"gopkg.in/asn1-ber.v1"
 )
 
-const (
-	EntryStatePresent = 0
-	EntryStateAdd     = 1
-	EntryStateModify  = 2
-	EntryStateDelete  = 3
-)
-
 const (
 	ControlTypePaging                 = "1.2.840.113556.1.4.319"
 	ControlTypeBeheraPasswordPolicy   = "1.3.6.1.4.1.42.2.27.8.5.1"
@@ -23,6 +16,9 @@ const (
 
 	ControlTypeChangeNotify = "1.2.840.113556.1.4.528"
 
+	// Tree Delete -- draft-armijo-ldap-treedelete
+	ControlTypeTreeDelete = "1.2.840.113556.1.4.805"
+
 	// Content Synchronization Operation -- RFC 4533
 	ControlTypeContentSync      = "1.3.6.1.4.1.4203.1.9.1.1"
 	ControlTypeContentSyncState = "1.3.6.1.4.1.4203.1.9.1.2"
@@ -62,11 +58,28 @@ func DecodeControl(packet *ber.Packet) Control {
 	criticality := false
 
 	packet.Children[0].Description = "Control Type (" + ControlTypeMap[controlType] + ")"
-	value := packet.Children[1]
-	if len(packet.Children) == 3 {
-		value = packet.Children[2]
-		packet.Children[1].Description = "Criticality"
-		criticality = packet.Children[1].Value.(bool)
+	var value *ber.Packet
+	for _, child := range packet.Children[1:] {
+		if child.Tag == ber.TagBoolean {
+			child.Description = "Criticality"
+			criticality = child.Value.(bool)
+		} else {
+			value = child
+		}
+	}
+
+	// The control value is optional, e.g. for request controls
+	if value == nil {
+		switch controlType {
+		case ControlTypeBeheraPasswordPolicy:
+			return NewControlBeheraPasswordPolicy()
+		case ControlTypeTreeDelete:
+			return &ControlTreeDelete{Criticality: criticality}
+		case ControlTypeContentSyncDone:
+			return &ControlContentSyncDone{}
+		default:
+			return &ControlString{ControlType: controlType, Criticality: criticality}
+		}
 	}
 
 	value.Description = "Control Value"
@@ -95,6 +108,10 @@ func DecodeControl(packet *ber.Packet) Control {
 		result := &ControlContentSyncState{}
 		result.decode(criticality, value)
 		return result
+	case ControlTypeContentSyncDone:
+		result := &ControlContentSyncDone{}
+		result.decode(criticality, value)
+		return result
 	default:
 		result := new(ControlString)
 		result.ControlType = controlType
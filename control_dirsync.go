@@ -11,6 +11,21 @@ func init() {
 	ControlTypeMap[ControlTypeDirSyncEx] = "DIRSYNC EX"
 }
 
+// DirSync request flags, see
+// https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-adts/2213a7f2-0a36-483c-b2a4-8574d53aa1e3
+const (
+	// DirSyncObjectSecurity returns the changes to all objects the caller
+	// can read instead of requiring the right to replicate changes
+	DirSyncObjectSecurity = 0x00000001
+	// DirSyncAncestorsFirstOrder returns parents before their children
+	DirSyncAncestorsFirstOrder = 0x00000800
+	// DirSyncPublicDataOnly omits private data such as passwords
+	DirSyncPublicDataOnly = 0x00002000
+	// DirSyncIncrementalValues returns only the changed values of
+	// multi-valued attributes instead of all values
+	DirSyncIncrementalValues = 0x80000000
+)
+
 func NewControlDirSync(flags, maxAttributes uint64, cookie []byte) *ControlDirSync {
 	return &ControlDirSync{
 		Criticality:       true,
@@ -38,7 +53,9 @@ func (c *ControlDirSync) Encode() *ber.Packet {
 	p2 := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, "Control Value (DIRSYNC)")
 	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "DIRSYNC Control Value")
 
-	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, uint64(c.Flags), "Flags"))
+	// The flags are a 32 bit signed integer, DirSyncIncrementalValues
+	// makes it negative
+	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(int32(c.Flags)), "Flags"))
 	seq.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, uint64(c.MaxAttributeCount), "MaxAttributeCount"))
 
 	cookie := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, "Cookie")
@@ -68,7 +85,7 @@ func (c *ControlDirSync) decode(criticality bool, value *ber.Packet) {
 	value.Children[0].Description = "Flags"
 	value.Children[1].Description = "MaxAttributeCount"
 	value.Children[2].Description = "Cookie"
-	c.Flags = uint64(value.Children[0].Value.(int64))
+	c.Flags = uint64(uint32(value.Children[0].Value.(int64)))
 	c.MaxAttributeCount = uint64(value.Children[1].Value.(int64))
 	c.Cookie = value.Children[2].Data.Bytes()
 	value.Children[2].Value = c.Cookie
@@ -89,6 +106,12 @@ func (c *ControlDirSync) SetCookie(cookie []byte) {
 	c.Cookie = cookie
 }
 
+// MoreData returns true if c was returned with a search result and the
+// server has more changes to send right away.
+func (c *ControlDirSync) MoreData() bool {
+	return c.Flags != 0
+}
+
 type ControlDirSyncEx struct {
 	Flag uint64
 }
@@ -47,13 +47,17 @@ func (c *ControlBeheraPasswordPolicy) decode(criticality bool, value *ber.Packet
 
 	sequence := value.Children[0]
 
+	// The warning and error elements are context tagged primitives, so
+	// their integer value has to be parsed from the content octets.
 	for _, child := range sequence.Children {
 		if child.Tag == 0 {
 			//Warning
+			if len(child.Children) == 0 {
+				continue
+			}
 			child := child.Children[0]
-			packet := ber.DecodePacket(child.Data.Bytes())
-			val, ok := packet.Value.(int64)
-			if ok {
+			val, err := ber.ParseInt64(child.Data.Bytes())
+			if err == nil {
 				if child.Tag == 0 {
 					//timeBeforeExpiration
 					c.Expire = val
@@ -66,13 +70,12 @@ func (c *ControlBeheraPasswordPolicy) decode(criticality bool, value *ber.Packet
 			}
 		} else if child.Tag == 1 {
 			// Error
-			packet := ber.DecodePacket(child.Data.Bytes())
-			val, ok := packet.Value.(int8)
-			if !ok {
+			val, err := ber.ParseInt64(child.Data.Bytes())
+			if err != nil {
 				// what to do?
 				val = -1
 			}
-			c.Error = val
+			c.Error = int8(val)
 			child.Value = c.Error
 			c.ErrorString = BeheraPasswordPolicyErrorMap[c.Error]
 		}
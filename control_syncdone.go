@@ -0,0 +1,84 @@
+package ldap
+
+import (
+	"fmt"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+func init() {
+	ControlTypeMap[ControlTypeContentSyncDone] = "Sync Done"
+}
+
+// ControlContentSyncDone is returned with the result of a content
+// synchronization search. RefreshDeletes is set if the refresh ended with
+// a delete phase; otherwise it ended with a present phase and entries not
+// reported as present have been deleted.
+type ControlContentSyncDone struct {
+	Cookie         []byte
+	RefreshDeletes bool
+}
+
+func (c *ControlContentSyncDone) GetControlType() string {
+	return ControlTypeContentSyncDone
+}
+
+func (c *ControlContentSyncDone) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ControlTypeContentSyncDone, "Control Type ("+ControlTypeMap[ControlTypeContentSyncDone]+")"))
+
+	p2 := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, "Control Value (Sync Done)")
+	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Sync Done Value")
+
+	if c.Cookie != nil {
+		cookie := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, "Cookie")
+		cookie.Value = c.Cookie
+		cookie.Data.Write(c.Cookie)
+		seq.AppendChild(cookie)
+	}
+	if c.RefreshDeletes {
+		seq.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, c.RefreshDeletes, "Refresh Deletes"))
+	}
+
+	p2.AppendChild(seq)
+
+	packet.AppendChild(p2)
+	return packet
+}
+
+func (c *ControlContentSyncDone) decode(criticality bool, value *ber.Packet) {
+	value.Description = "Control Value (Sync Done)"
+
+	if value.Value == nil {
+		return
+	}
+
+	valueChildren := ber.DecodePacket(value.Data.Bytes())
+	value.Data.Truncate(0)
+	value.Value = nil
+	value.AppendChild(valueChildren)
+
+	for _, child := range valueChildren.Children {
+		switch child.Tag {
+		case ber.TagOctetString:
+			child.Description = "Cookie"
+			c.Cookie = child.Data.Bytes()
+		case ber.TagBoolean:
+			child.Description = "Refresh Deletes"
+			c.RefreshDeletes, _ = child.Value.(bool)
+		}
+	}
+}
+
+func (c *ControlContentSyncDone) String() string {
+	return fmt.Sprintf(
+		"Control Type: %s (%q) RefreshDeletes: %v Cookie: %x",
+		ControlTypeMap[ControlTypeContentSyncDone],
+		ControlTypeContentSyncDone,
+		c.RefreshDeletes,
+		c.Cookie)
+}
+
+func (c *ControlContentSyncDone) SetCookie(cookie []byte) {
+	c.Cookie = cookie
+}
@@ -0,0 +1,44 @@
+package ldap
+
+import (
+	"fmt"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+func init() {
+	ControlTypeMap[ControlTypeTreeDelete] = "Tree Delete"
+}
+
+// ControlTreeDelete asks the server to delete an entry together with all
+// of its subordinates (draft-armijo-ldap-treedelete). It is supported by
+// Active Directory and by OpenLDAP, which implements the same OID as its
+// subtree delete control.
+type ControlTreeDelete struct {
+	Criticality bool
+}
+
+func NewControlTreeDelete() *ControlTreeDelete {
+	return &ControlTreeDelete{Criticality: true}
+}
+
+func (c *ControlTreeDelete) GetControlType() string {
+	return ControlTypeTreeDelete
+}
+
+func (c *ControlTreeDelete) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, ControlTypeTreeDelete, "Control Type ("+ControlTypeMap[ControlTypeTreeDelete]+")"))
+	if c.Criticality {
+		packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, c.Criticality, "Criticality"))
+	}
+	return packet
+}
+
+func (c *ControlTreeDelete) String() string {
+	return fmt.Sprintf(
+		"Control Type: %s (%q)  Criticality: %t",
+		ControlTypeMap[ControlTypeTreeDelete],
+		ControlTypeTreeDelete,
+		c.Criticality)
+}
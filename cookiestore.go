@@ -0,0 +1,81 @@
+package ldap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CookieStore persists the cookie of a synchronization, so it can resume
+// where it stopped.
+type CookieStore interface {
+	// Load returns the stored cookie, or nil if there is none.
+	Load() ([]byte, error)
+
+	// Save replaces the stored cookie. A nil cookie removes it.
+	Save(cookie []byte) error
+}
+
+// FileCookieStore stores the cookie in a file. The file is replaced
+// atomically, so a crash leaves either the previous or the new cookie.
+type FileCookieStore struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewFileCookieStore returns a store for the cookie in the file at path.
+func NewFileCookieStore(path string) *FileCookieStore {
+	return &FileCookieStore{Path: path}
+}
+
+// Load returns the cookie in the file, or nil if the file does not exist.
+func (s *FileCookieStore) Load() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cookie, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return cookie, err
+}
+
+// Save writes cookie to a temporary file next to the store's file and
+// renames it over the store's file. A nil cookie removes the file.
+func (s *FileCookieStore) Save(cookie []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cookie == nil {
+		if err := os.Remove(s.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(cookie); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), s.Path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
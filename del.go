@@ -0,0 +1,143 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+// File contains Delete functionality
+//
+// https://tools.ietf.org/html/rfc4511
+//
+// DelRequest ::= [APPLICATION 10] LDAPDN
+//
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+type DelRequest struct {
+	DN       string
+	Controls []Control
+}
+
+func (d DelRequest) encode() *ber.Packet {
+	return ber.NewString(ber.ClassApplication, ber.TypePrimitive, ApplicationDelRequest, d.DN, "Del Request")
+}
+
+// NewDelRequest creates a request to delete the entry dn.
+func NewDelRequest(dn string, controls []Control) *DelRequest {
+	return &DelRequest{
+		DN:       dn,
+		Controls: controls,
+	}
+}
+
+// Del deletes the entry named by delRequest.DN. Only leaf entries can be
+// deleted unless the server supports and is sent a ControlTreeDelete.
+func (l *Conn) Del(delRequest *DelRequest) error {
+	return l.DelContext(context.Background(), delRequest)
+}
+
+// DelContext is like Del, but gives up waiting for the response and
+// abandons the request when ctx is done.
+func (l *Conn) DelContext(ctx context.Context, delRequest *DelRequest) error {
+	messageID := l.nextMessageID()
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(delRequest.encode())
+	if len(delRequest.Controls) > 0 {
+		packet.AppendChild(encodeControls(delRequest.Controls))
+	}
+
+	l.Debug.PrintPacket(packet)
+
+	channel, err := l.sendMessage(packet)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return NewError(ErrorNetwork, errors.New("ldap: could not send message"))
+	}
+	defer l.finishMessage(messageID)
+
+	l.Debug.Printf("%d: waiting for response", messageID)
+	packet, err = l.readPacket(ctx, messageID, channel)
+	if err != nil {
+		return err
+	}
+	l.Debug.Printf("%d: got response %p", messageID, packet)
+	if packet == nil {
+		return NewError(ErrorNetwork, errors.New("ldap: could not retrieve message"))
+	}
+
+	if l.Debug {
+		if err := addLDAPDescriptions(packet); err != nil {
+			return err
+		}
+		ber.PrintPacket(packet)
+	}
+
+	if packet.Children[1].Tag == ApplicationDelResponse {
+		resultCode, resultDescription := getLDAPResultCode(packet)
+		if resultCode != 0 {
+			return newResultError(packet, resultCode, resultDescription)
+		}
+	} else {
+		return NewError(ErrorUnexpectedResponse, fmt.Errorf("Unexpected Response: %d", packet.Children[1].Tag))
+	}
+
+	l.Debug.Printf("%d: returning", messageID)
+	return nil
+}
+
+// DelTree deletes dn and every entry below it from the client side, for
+// servers that do not support ControlTreeDelete. The subtree is read with a
+// paged search and entries are deleted deepest first, so each delete only
+// ever targets a leaf. The controls are sent with every delete request.
+func (l *Conn) DelTree(dn string, controls []Control) error {
+	return l.DelTreeContext(context.Background(), dn, controls)
+}
+
+// DelTreeContext is like DelTree, but stops and abandons the outstanding
+// request when ctx is done.
+func (l *Conn) DelTreeContext(ctx context.Context, dn string, controls []Control) error {
+	searchRequest := NewSearchRequest(
+		dn, ScopeWholeSubtree, NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		[]string{"1.1"},
+		nil,
+	)
+	result, err := l.SearchWithPagingContext(ctx, searchRequest, 500)
+	if err != nil {
+		return err
+	}
+
+	type subtreeEntry struct {
+		dn    string
+		depth int
+	}
+	entries := make([]subtreeEntry, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		parsed, err := ParseDN(entry.DN)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, subtreeEntry{dn: entry.DN, depth: len(parsed.RDNs)})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].depth > entries[j].depth
+	})
+
+	for _, entry := range entries {
+		l.Debug.Printf("Deleting %s", entry.dn)
+		if err := l.DelContext(ctx, NewDelRequest(entry.dn, controls)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
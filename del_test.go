@@ -0,0 +1,83 @@
+package ldap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDel(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	done := make(chan error)
+	go func() {
+		done <- l.Del(NewDelRequest("ou=people,dc=example,dc=com", []Control{NewControlTreeDelete()}))
+	}()
+
+	request := <-requests
+	if del := request.Children[1]; del.Tag != ApplicationDelRequest || string(del.Data.Bytes()) != "ou=people,dc=example,dc=com" {
+		t.Fatalf("unexpected delete request for %q", del.Data.Bytes())
+	}
+	if len(request.Children) != 3 || request.Children[2].Children[0].Children[0].Value != ControlTypeTreeDelete {
+		t.Error("expected the tree delete control with the request")
+	}
+
+	writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationDelResponse, LDAPResultNotAllowedOnNonLeaf, ""))
+	if err := <-done; !IsErrorWithCode(err, LDAPResultNotAllowedOnNonLeaf) {
+		t.Fatalf("expected LDAPResultNotAllowedOnNonLeaf, got %v", err)
+	}
+}
+
+func TestDelTree(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	done := make(chan error)
+	go func() {
+		done <- l.DelTree("ou=people,dc=example,dc=com", nil)
+	}()
+
+	// The subtree is returned parents first, as servers usually do
+	search := <-requests
+	if search.Children[1].Tag != ApplicationSearchRequest {
+		t.Fatalf("expected a search request, got tag %d", search.Children[1].Tag)
+	}
+	messageID := search.Children[0].Value.(int64)
+	for _, dn := range []string{
+		"ou=people,dc=example,dc=com",
+		"ou=staff,ou=people,dc=example,dc=com",
+		"cn=a,ou=people,dc=example,dc=com",
+		"cn=b,ou=staff,ou=people,dc=example,dc=com",
+	} {
+		writeResponse(t, server, messageID, newSearchEntry(dn, "objectClass", "top"))
+	}
+	writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""), &ControlPaging{})
+
+	var deleted []string
+	for i := 0; i < 4; i++ {
+		request := <-requests
+		if request.Children[1].Tag != ApplicationDelRequest {
+			t.Fatalf("expected a delete request, got tag %d", request.Children[1].Tag)
+		}
+		deleted = append(deleted, string(request.Children[1].Data.Bytes()))
+		writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationDelResponse, LDAPResultSuccess, ""))
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Deepest entries first, otherwise in the order they were found
+	want := []string{
+		"cn=b,ou=staff,ou=people,dc=example,dc=com",
+		"ou=staff,ou=people,dc=example,dc=com",
+		"cn=a,ou=people,dc=example,dc=com",
+		"ou=people,dc=example,dc=com",
+	}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted %q, expected %q", deleted, want)
+	}
+}
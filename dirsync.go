@@ -1,21 +1,43 @@
 package ldap
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 )
 
+// DefaultDirSyncInterval is the time to wait for new changes after the
+// server sent all changes.
+const DefaultDirSyncInterval = 10 * time.Second
+
+// Default retry backoff of a DirSyncSession
+const (
+	DefaultDirSyncBackoff    = time.Second
+	DefaultDirSyncMaxBackoff = time.Minute
+)
+
+// GetDirSyncRequest returns a DirSync search request for the base object
+// without flags and with at most 1000 attribute values per response. Use
+// GetDirSyncRequestWithOptions to choose them.
 func GetDirSyncRequest(baseDn, filter string, cookie []byte) *SearchRequest {
+	return GetDirSyncRequestWithOptions(baseDn, filter, ScopeBaseObject, 0, 1000, cookie)
+}
+
+// GetDirSyncRequestWithOptions returns a DirSync search request with the
+// given scope, DirSync* flags and limit of attribute values per response.
+// A maxAttributeCount of 0 leaves the limit to the server.
+func GetDirSyncRequestWithOptions(baseDn, filter string, scope int, flags, maxAttributeCount uint64, cookie []byte) *SearchRequest {
 	sizeLimit := 0
 	timeLimit := 0
 	typesOnly := false
 
-	dirSyncControl := NewControlDirSync(0, 1000, cookie)
+	dirSyncControl := NewControlDirSync(flags, maxAttributeCount, cookie)
 	dirSyncControlEx := NewControlDirSyncEx(1)
 
 	searchRequest := NewSearchRequest(
-		baseDn, ScopeBaseObject, NeverDerefAliases,
+		baseDn, scope, NeverDerefAliases,
 		sizeLimit, timeLimit, typesOnly, filter,
 		nil,
 		[]Control{dirSyncControl, dirSyncControlEx},
@@ -25,6 +47,12 @@ func GetDirSyncRequest(baseDn, filter string, cookie []byte) *SearchRequest {
 }
 
 func (l *Conn) RunDirSync(searchRequest *SearchRequest, callback func([]*Entry, []byte) error) error {
+	return l.RunDirSyncContext(context.Background(), searchRequest, callback)
+}
+
+// RunDirSyncContext is like RunDirSync, but returns when ctx is done,
+// abandoning the outstanding search if there is one.
+func (l *Conn) RunDirSyncContext(ctx context.Context, searchRequest *SearchRequest, callback func([]*Entry, []byte) error) error {
 
 	dirSyncControl, err := getDirSyncControl(searchRequest.Controls)
 	if err != nil {
@@ -32,7 +60,7 @@ func (l *Conn) RunDirSync(searchRequest *SearchRequest, callback func([]*Entry,
 	}
 
 	for {
-		result, err := l.Search(searchRequest)
+		result, err := l.SearchContext(ctx, searchRequest)
 		if err != nil {
 			return err
 		}
@@ -56,13 +84,181 @@ func (l *Conn) RunDirSync(searchRequest *SearchRequest, callback func([]*Entry,
 		}
 
 		if len(result.Entries) == 0 {
-			time.Sleep(10 * time.Second)
+			select {
+			case <-time.After(DefaultDirSyncInterval):
+			case <-ctx.Done():
+				return NewError(ErrorCanceled, ctx.Err())
+			}
 		} else {
 			dirSyncControl.SetCookie(cookie)
 		}
 	}
 }
 
+// DirSyncProgress reports a round of a DirSyncSession.
+type DirSyncProgress struct {
+	// Entries are the changed entries sent in this round.
+	Entries []*Entry
+
+	// Cookie is the cookie to resume after this round.
+	Cookie []byte
+
+	// MoreData is true if the server has more changes, which the session
+	// fetches right away.
+	MoreData bool
+
+	// Round counts the searches of the session, starting at 1, and Total
+	// the entries sent so far, including this round's.
+	Round int
+	Total int
+}
+
+// DirSyncSession polls Active Directory for changes with the DirSync
+// control. It fetches again right away while the server has more data,
+// and waits for Interval plus a random part of Jitter once it sent all
+// changes.
+type DirSyncSession struct {
+	// BaseDN, Filter, Scope and Attributes select the entries to
+	// synchronize. BaseDN has to be the root of a naming context.
+	BaseDN     string
+	Filter     string
+	Scope      int
+	Attributes []string
+
+	// Flags are the DirSync* flags, e.g. DirSyncIncrementalValues.
+	Flags uint64
+
+	// MaxAttributeCount limits the attribute values per response, 0
+	// leaves the limit to the server.
+	MaxAttributeCount uint64
+
+	// Cookie resumes a previous session, nil fetches all entries.
+	Cookie []byte
+
+	// Controls are sent with the search in addition to the DirSync
+	// controls.
+	Controls []Control
+
+	// Interval defaults to DefaultDirSyncInterval.
+	Interval time.Duration
+	Jitter   time.Duration
+
+	// Backoff is the time to wait before retrying a search the server
+	// refused as busy or unavailable. It doubles with every further
+	// failure, up to MaxBackoff. DefaultDirSyncBackoff and
+	// DefaultDirSyncMaxBackoff are used if they are not set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Handler receives each round. The session stops and returns the
+	// error if it returns one. The cookie should be saved once the
+	// entries were handled.
+	Handler func(*DirSyncProgress) error
+}
+
+// Run searches for changes until ctx is done, the search fails or the
+// handler returns an error. Searches the server refuses as busy or
+// unavailable are retried with backoff. Other errors, including the loss
+// of the connection, are returned; a new session can resume from the last
+// cookie passed to the handler.
+func (s *DirSyncSession) Run(ctx context.Context, l *Conn) error {
+	if s.Handler == nil {
+		return errors.New("ldap: DirSyncSession needs a Handler")
+	}
+	filter := s.Filter
+	if filter == "" {
+		filter = "(objectClass=*)"
+	}
+	searchRequest := GetDirSyncRequestWithOptions(s.BaseDN, filter, s.Scope, s.Flags, s.MaxAttributeCount, s.Cookie)
+	searchRequest.Attributes = s.Attributes
+	searchRequest.Controls = append(searchRequest.Controls, s.Controls...)
+	dirSyncControl, err := getDirSyncControl(searchRequest.Controls)
+	if err != nil {
+		return err
+	}
+
+	round, total := 0, 0
+	backoff := s.initialBackoff()
+	for {
+		result, err := l.SearchContext(ctx, searchRequest)
+		if err != nil {
+			if l.Err() != nil || !isTransientSyncError(err) {
+				return err
+			}
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return NewError(ErrorCanceled, ctx.Err())
+			}
+			backoff *= 2
+			if max := s.maxBackoff(); backoff > max {
+				backoff = max
+			}
+			continue
+		}
+		backoff = s.initialBackoff()
+		dirSync, err := getDirSyncControl(result.Controls)
+		if err != nil {
+			return err
+		}
+		if len(dirSync.Cookie) == 0 {
+			return errors.New("ldap: dirsync cookie in the result is empty")
+		}
+
+		round++
+		total += len(result.Entries)
+		progress := &DirSyncProgress{
+			Entries:  result.Entries,
+			Cookie:   dirSync.Cookie,
+			MoreData: dirSync.MoreData(),
+			Round:    round,
+			Total:    total,
+		}
+		if err := s.Handler(progress); err != nil {
+			return err
+		}
+		dirSyncControl.SetCookie(dirSync.Cookie)
+
+		if progress.MoreData {
+			if ctx.Err() != nil {
+				return NewError(ErrorCanceled, ctx.Err())
+			}
+			continue
+		}
+		select {
+		case <-time.After(s.wait()):
+		case <-ctx.Done():
+			return NewError(ErrorCanceled, ctx.Err())
+		}
+	}
+}
+
+// wait returns the time to wait for new changes.
+func (s *DirSyncSession) wait() time.Duration {
+	wait := s.Interval
+	if wait <= 0 {
+		wait = DefaultDirSyncInterval
+	}
+	if s.Jitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(s.Jitter)))
+	}
+	return wait
+}
+
+func (s *DirSyncSession) initialBackoff() time.Duration {
+	if s.Backoff > 0 {
+		return s.Backoff
+	}
+	return DefaultDirSyncBackoff
+}
+
+func (s *DirSyncSession) maxBackoff() time.Duration {
+	if s.MaxBackoff > 0 {
+		return s.MaxBackoff
+	}
+	return DefaultDirSyncMaxBackoff
+}
+
 func getDirSyncControl(controls []Control) (*ControlDirSync, error) {
 	control := FindControl(controls, ControlTypeDirSync)
 	if control == nil {
@@ -0,0 +1,133 @@
+package ldap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// requestDirSync returns the DirSync control of a search request.
+func requestDirSync(t *testing.T, request *ber.Packet) *ControlDirSync {
+	control := DecodeControl(ber.DecodePacket(request.Children[2].Children[0].Bytes()))
+	dirSync, ok := control.(*ControlDirSync)
+	if !ok {
+		t.Fatalf("expected a DirSync control, got %T", control)
+	}
+	return dirSync
+}
+
+func TestControlDirSyncFlags(t *testing.T) {
+	flags := uint64(DirSyncObjectSecurity | DirSyncIncrementalValues)
+	packet := ber.DecodePacket(NewControlDirSync(flags, 0, nil).Encode().Bytes())
+	value := ber.DecodePacket(packet.Children[2].Data.Bytes())
+	if got := value.Children[0].Value.(int64); got != -0x7fffffff {
+		t.Errorf("encoded flags as %d, expected a negative 32 bit integer", got)
+	}
+	if got := DecodeControl(packet).(*ControlDirSync).Flags; got != flags {
+		t.Errorf("decoded flags %#x, expected %#x", got, flags)
+	}
+}
+
+func TestGetDirSyncRequest(t *testing.T) {
+	request := GetDirSyncRequest("dc=example,dc=com", "(objectClass=*)", nil)
+	dirSync, err := getDirSyncControl(request.Controls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Scope != ScopeBaseObject || dirSync.Flags != 0 || dirSync.MaxAttributeCount != 1000 {
+		t.Errorf("unexpected default request, scope %d and control %s", request.Scope, dirSync)
+	}
+
+	request = GetDirSyncRequestWithOptions("dc=example,dc=com", "(objectClass=*)", ScopeWholeSubtree, DirSyncIncrementalValues, 0, []byte("c1"))
+	dirSync, err = getDirSyncControl(request.Controls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Scope != ScopeWholeSubtree || dirSync.Flags != DirSyncIncrementalValues || dirSync.MaxAttributeCount != 0 || string(dirSync.Cookie) != "c1" {
+		t.Errorf("unexpected request, scope %d and control %s", request.Scope, dirSync)
+	}
+}
+
+func TestDirSyncSession(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The handler keeps the progress of each round
+	var rounds []*DirSyncProgress
+	session := &DirSyncSession{
+		BaseDN:            "dc=example,dc=com",
+		Scope:             ScopeWholeSubtree,
+		Flags:             DirSyncObjectSecurity | DirSyncIncrementalValues,
+		MaxAttributeCount: 500,
+		Interval:          time.Hour,
+		Backoff:           time.Millisecond,
+		Handler: func(progress *DirSyncProgress) error {
+			rounds = append(rounds, progress)
+			if !progress.MoreData {
+				cancel()
+			}
+			return nil
+		},
+	}
+	done := make(chan error)
+	go func() {
+		done <- session.Run(ctx, l)
+	}()
+
+	// The first round has more data, so the second one follows right away
+	request := <-requests
+	if scope := request.Children[1].Children[1].Value.(int64); scope != ScopeWholeSubtree {
+		t.Errorf("searched with scope %d, expected %d", scope, ScopeWholeSubtree)
+	}
+	dirSync := requestDirSync(t, request)
+	if dirSync.Flags != DirSyncObjectSecurity|DirSyncIncrementalValues || dirSync.MaxAttributeCount != 500 || len(dirSync.Cookie) != 0 {
+		t.Errorf("unexpected request control %s", dirSync)
+	}
+	messageID := request.Children[0].Value.(int64)
+	writeResponse(t, server, messageID, newSearchEntry("cn=a,dc=example,dc=com", "member", "cn=b,dc=example,dc=com"))
+	writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""),
+		&ControlDirSync{Flags: 1, Cookie: []byte("c1")})
+
+	// A busy server is retried with the same cookie
+	request = <-requests
+	if dirSync := requestDirSync(t, request); string(dirSync.Cookie) != "c1" {
+		t.Errorf("requested with cookie %q, expected c1", dirSync.Cookie)
+	}
+	writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationSearchResultDone, LDAPResultBusy, ""))
+
+	request = <-requests
+	if dirSync := requestDirSync(t, request); string(dirSync.Cookie) != "c1" {
+		t.Errorf("retried with cookie %q, expected c1", dirSync.Cookie)
+	}
+	messageID = request.Children[0].Value.(int64)
+	writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""),
+		&ControlDirSync{Cookie: []byte("c2")})
+
+	select {
+	case err := <-done:
+		if !IsErrorWithCode(err, ErrorCanceled) {
+			t.Fatalf("expected ErrorCanceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was canceled")
+	}
+
+	if len(rounds) != 2 {
+		t.Fatalf("got %d rounds, expected 2", len(rounds))
+	}
+	if first := rounds[0]; first.Round != 1 || !first.MoreData || string(first.Cookie) != "c1" ||
+		len(first.Entries) != 1 || first.Total != 1 {
+		t.Errorf("unexpected first round %+v", first)
+	}
+	if second := rounds[1]; second.Round != 2 || second.MoreData || string(second.Cookie) != "c2" ||
+		len(second.Entries) != 0 || second.Total != 1 {
+		t.Errorf("unexpected second round %+v", second)
+	}
+}
@@ -1,9 +1,11 @@
 package ldap_test
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/go-ldap/ldap"
 )
@@ -49,6 +51,55 @@ func ExampleConn_Search() {
 	}
 }
 
+// ExampleConn_SaslBind demonstrates how to authenticate with the client
+// certificate of a TLS connection
+func ExampleConn_SaslBind() {
+	cert, err := tls.LoadX509KeyPair("client.crt", "client.key")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	l, err := ldap.DialTLS("tcp", fmt.Sprintf("%s:%d", "ldap.example.com", 636), &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	_, err = l.SaslBind(ldap.NewSaslBindRequest(ldap.NewSaslExternal(""), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ExampleConn_SearchAsync demonstrates how to process a large search result
+// one entry at a time, without holding all entries in memory
+func ExampleConn_SearchAsync() {
+	l, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", "ldap.example.com", 389))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		"dc=example,dc=com", // The base dn to search
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(&(objectClass=organizationalPerson))", // The filter to apply
+		[]string{"dn", "cn"},                    // A list attributes to retrieve
+		nil,
+	)
+
+	response := l.SearchAsync(context.Background(), searchRequest)
+	defer response.Close()
+	for response.Next() {
+		if entry := response.Entry(); entry != nil {
+			fmt.Printf("%s: %v\n", entry.DN, entry.GetAttributeValue("cn"))
+		}
+	}
+	if err := response.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
 // ExampleStartTLS demonstrates how to start a TLS connection
 func ExampleConn_StartTLS() {
 	l, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", "ldap.example.com", 389))
@@ -162,6 +213,81 @@ func ExampleConn_Modify() {
 	}
 }
 
+func ExampleConn_Add() {
+	l, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", "ldap.example.com", 389))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	// Create a new user entry
+	add := ldap.NewAddRequest("cn=user,dc=example,dc=com", nil)
+	add.Attribute("objectClass", []string{"inetOrgPerson"})
+	add.Attribute("cn", []string{"user"})
+	add.Attribute("sn", []string{"User"})
+	add.Attribute("mail", []string{"user@example.org"})
+
+	err = l.Add(add)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleConn_Del() {
+	l, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", "ldap.example.com", 389))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	err = l.Del(ldap.NewDelRequest("cn=user,dc=example,dc=com", nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ExampleConn_DelTree demonstrates how to remove a whole organizational
+// unit, using the tree delete control when the server supports it
+func ExampleConn_DelTree() {
+	l, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", "ldap.example.com", 389))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	dn := "ou=contractors,dc=example,dc=com"
+	err = l.Del(ldap.NewDelRequest(dn, []ldap.Control{ldap.NewControlTreeDelete()}))
+	if e, ok := err.(*ldap.Error); ok && e.ResultCode == ldap.LDAPResultUnavailableCriticalExtension {
+		// The server does not know the control, delete entry by entry instead
+		err = l.DelTree(dn, nil)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// ExampleConn_ModifyDN demonstrates how to rename an entry and how to move
+// it below another parent
+func ExampleConn_ModifyDN() {
+	l, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", "ldap.example.com", 389))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	// Rename the entry, replacing the old cn value
+	req := ldap.NewModifyDNRequest("cn=Jane Smith,ou=people,dc=example,dc=com", "cn=Jane Doe", true, "", nil)
+	if err = l.ModifyDN(req); err != nil {
+		log.Fatal(err)
+	}
+
+	// Move the entry to another organizational unit, keeping its name
+	req = ldap.NewModifyDNRequest("cn=Jane Doe,ou=people,dc=example,dc=com", "cn=Jane Doe", true, "ou=alumni,dc=example,dc=com", nil)
+	if err = l.ModifyDN(req); err != nil {
+		log.Fatal(err)
+	}
+}
+
 // Example User Authentication shows how a typical application can verify a login attempt
 func Example_userAuthentication() {
 	// The username and password we want to check
@@ -261,6 +387,41 @@ func Example_beherappolicy() {
 	}
 }
 
+// ExampleSimpleBindResult_PasswordPolicy demonstrates how to check the
+// password policy state of a user at login time
+func ExampleSimpleBindResult_PasswordPolicy() {
+	l, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", "ldap.example.com", 389))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	controls := []ldap.Control{ldap.NewControlBeheraPasswordPolicy()}
+	bindRequest := ldap.NewSimpleBindRequest("cn=user,dc=example,dc=com", "password", controls)
+
+	r, err := l.SimpleBind(bindRequest)
+	if r == nil {
+		log.Fatal(err)
+	}
+	if status := r.PasswordPolicy(); status != nil {
+		switch {
+		case status.Locked:
+			log.Print("Account locked")
+		case status.Expired && status.GraceLoginsRemaining >= 0:
+			log.Printf("Password expired, %d grace logins remain", status.GraceLoginsRemaining)
+		case status.Expired:
+			log.Print("Password expired")
+		case status.MustChange:
+			log.Print("Password must be changed")
+		case status.SecondsBeforeExpiration >= 0:
+			log.Printf("Password expires in %d seconds", status.SecondsBeforeExpiration)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func Example_vchuppolicy() {
 	l, err := ldap.Dial("tcp", fmt.Sprintf("%s:%d", "ldap.example.com", 389))
 	if err != nil {
@@ -303,3 +464,111 @@ func Example_vchuppolicy() {
 		log.Print(logStr)
 	}
 }
+
+// This example shows how to share bound connections between goroutines
+func ExampleNewPool() {
+	pool := ldap.NewPool(ldap.PoolConfig{
+		Network:      "tcp",
+		Addr:         fmt.Sprintf("%s:%d", "ldap.example.com", 389),
+		BindDN:       "cn=read-only-admin,dc=example,dc=com",
+		BindPassword: "password",
+		MaxOpen:      10,
+	})
+	defer pool.Close()
+
+	l, err := pool.Get(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	searchRequest := ldap.NewSearchRequest(
+		"dc=example,dc=com",
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(&(objectClass=organizationalPerson))",
+		[]string{"dn", "cn"},
+		nil,
+	)
+	sr, err := l.Search(searchRequest)
+	if err != nil {
+		pool.Discard(l)
+		log.Fatal(err)
+	}
+	pool.Put(l)
+
+	fmt.Printf("%d entries\n", len(sr.Entries))
+}
+
+// This example shows how to search a replicated directory, failing over to
+// the next server when a connection breaks
+func ExampleNewFailoverClient() {
+	c, err := ldap.NewFailoverClient(ldap.FailoverConfig{
+		URLs:         []string{"ldaps://ldap1.example.com", "ldaps://ldap2.example.com"},
+		BindDN:       "cn=read-only-admin,dc=example,dc=com",
+		BindPassword: "password",
+		Retry:        ldap.RetryPolicy{MaxAttempts: 3, Backoff: 100 * time.Millisecond},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	searchRequest := ldap.NewSearchRequest(
+		"dc=example,dc=com",
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(&(objectClass=organizationalPerson))",
+		[]string{"dn", "cn"},
+		nil,
+	)
+	sr, err := c.Search(searchRequest)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%d entries from %s\n", len(sr.Entries), c.URL())
+}
+
+// This example shows how to bind as the local user over the slapd Unix
+// socket
+func ExampleDialURL() {
+	l, err := ldap.DialURL("ldapi://%2Fvar%2Frun%2Fslapd%2Fldapi")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	_, err = l.SaslBind(ldap.NewSaslBindRequest(ldap.NewSaslExternal(""), nil))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// This example shows how to connect to the domain controllers of an Active
+// Directory domain found via DNS SRV records
+func ExampleSRVDiscovery() {
+	discovery := &ldap.SRVDiscovery{}
+	c, err := ldap.NewFailoverClient(ldap.FailoverConfig{
+		Discover: func(ctx context.Context) ([]string, error) {
+			return discovery.URLs(ctx, "dc._msdcs.example.com")
+		},
+		StartTLS:     true,
+		BindDN:       "cn=read-only-admin,dc=example,dc=com",
+		BindPassword: "password",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	sr, err := c.Search(ldap.NewSearchRequest(
+		"dc=example,dc=com",
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		"(&(objectClass=user)(sAMAccountName=jdoe))",
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%d entries from %s\n", len(sr.Entries), c.URL())
+}
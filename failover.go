@@ -0,0 +1,402 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how a FailoverClient retries idempotent operations
+// that failed on a network error.
+type RetryPolicy struct {
+	// MaxAttempts limits the number of attempts per operation, including
+	// the first one. 0 means one attempt per configured server, a negative
+	// value disables retrying.
+	MaxAttempts int
+
+	// Backoff is the time to wait before the first retry. It doubles with
+	// every further retry, up to MaxBackoff if that is set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// FailoverConfig configures a FailoverClient.
+type FailoverConfig struct {
+	// URLs lists the servers in order of preference as URLs accepted by
+	// DialURL, e.g. "ldaps://ldap1.example.com" or "ldap://10.0.0.2:3389".
+	URLs []string
+
+	// Discover, if set, is called before connecting to find the servers,
+	// e.g. with SRVDiscovery. The servers it returns are tried before
+	// URLs; servers in both lists are only tried once.
+	Discover func(ctx context.Context) ([]string, error)
+
+	// DialOpts are passed to DialURL.
+	DialOpts []DialOpt
+
+	// TLSConfig is used for ldaps:// URLs and StartTLS. If ServerName is
+	// not set, the host of the URL is used.
+	TLSConfig *tls.Config
+
+	// StartTLS upgrades connections to ldap:// URLs with StartTLS.
+	StartTLS bool
+
+	// BindDN and BindPassword are the credentials connections are bound
+	// with. If both are empty, connections stay anonymous.
+	BindDN       string
+	BindPassword string
+
+	// Bind, if set, is used instead of BindDN and BindPassword to bind
+	// connections, e.g. to use a SASL mechanism.
+	Bind func(*Conn) error
+
+	// Retry is the policy for retrying Search and Compare.
+	Retry RetryPolicy
+}
+
+// FailoverClient runs operations against the first reachable server of a
+// list. When a connection fails with a network error, the next operation
+// reconnects, starting over at the first server, and redoes StartTLS and
+// the bind. Search and Compare are retried according to the RetryPolicy;
+// other operations are not, as they may have been applied before the
+// connection failed. Its methods are safe for concurrent use.
+type FailoverClient struct {
+	config FailoverConfig
+
+	mu         sync.Mutex
+	conn       *Conn
+	url        string
+	servers    int
+	connecting chan struct{} // closed when the connect in progress is done
+}
+
+// NewFailoverClient returns a client for the servers in config. No
+// connection is opened until the first operation.
+func NewFailoverClient(config FailoverConfig) (*FailoverClient, error) {
+	if len(config.URLs) == 0 && config.Discover == nil {
+		return nil, NewError(ErrorNetwork, errors.New("ldap: no server URLs"))
+	}
+	for _, addr := range config.URLs {
+		if _, err := ParseLDAPURL(addr); err != nil {
+			return nil, NewError(ErrorNetwork, err)
+		}
+	}
+	return &FailoverClient{config: config}, nil
+}
+
+// Conn returns the current connection, connecting to the first reachable
+// server if there is none. Discover is called for every new connection.
+// Only one caller connects at a time, the others wait for its connection.
+func (c *FailoverClient) Conn(ctx context.Context) (*Conn, error) {
+	for {
+		c.mu.Lock()
+		if c.conn != nil && !c.conn.IsClosing() {
+			conn := c.conn
+			c.mu.Unlock()
+			return conn, nil
+		}
+		if c.conn != nil {
+			// Closing waits for the reader, which already stopped
+			c.conn.Close()
+			c.conn, c.url = nil, ""
+		}
+		if connecting := c.connecting; connecting != nil {
+			c.mu.Unlock()
+			select {
+			case <-connecting:
+				continue
+			case <-ctx.Done():
+				return nil, NewError(ErrorCanceled, ctx.Err())
+			}
+		}
+		connecting := make(chan struct{})
+		c.connecting = connecting
+		c.mu.Unlock()
+
+		// Discover, dial and bind without holding the lock, so URL and
+		// Close do not wait for slow servers
+		conn, addr, servers, err := c.connectFirst(ctx)
+
+		c.mu.Lock()
+		c.connecting = nil
+		close(connecting)
+		if servers > 0 {
+			c.servers = servers
+		}
+		if err == nil {
+			c.conn, c.url = conn, addr
+		}
+		c.mu.Unlock()
+		return conn, err
+	}
+}
+
+// connectFirst connects to the first reachable server. It returns the
+// connection, its URL and the number of servers.
+func (c *FailoverClient) connectFirst(ctx context.Context) (*Conn, string, int, error) {
+	var discovered []string
+	var err error
+	if c.config.Discover != nil {
+		discovered, err = c.config.Discover(ctx)
+		if err != nil && len(c.config.URLs) == 0 {
+			return nil, "", 0, err
+		}
+	}
+	urls := uniqueURLs(discovered, c.config.URLs)
+
+	for _, addr := range urls {
+		if ctx.Err() != nil {
+			return nil, "", len(urls), NewError(ErrorCanceled, ctx.Err())
+		}
+		var conn *Conn
+		conn, err = c.connect(ctx, addr)
+		if err != nil {
+			continue
+		}
+		return conn, addr, len(urls), nil
+	}
+	return nil, "", len(urls), err
+}
+
+// uniqueURLs returns the URLs of all lists in order, leaving out those
+// naming a server already listed, e.g. ldap://host and ldap://host:389.
+func uniqueURLs(lists ...[]string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, list := range lists {
+		for _, addr := range list {
+			key := addr
+			if u, err := ParseLDAPURL(addr); err == nil {
+				key = serverURL(u)
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			urls = append(urls, addr)
+		}
+	}
+	return urls
+}
+
+// URL returns the URL of the server currently connected to, or an empty
+// string if there is no connection.
+func (c *FailoverClient) URL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.url
+}
+
+// Close closes the current connection. The client reconnects on the next
+// operation.
+func (c *FailoverClient) Close() {
+	c.mu.Lock()
+	conn := c.conn
+	c.conn, c.url = nil, ""
+	c.mu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// Search performs the given search request, failing over to the next
+// server and retrying on network errors.
+func (c *FailoverClient) Search(searchRequest *SearchRequest) (*SearchResult, error) {
+	return c.SearchContext(context.Background(), searchRequest)
+}
+
+// SearchContext is like Search, but stops retrying and abandons the request
+// when ctx is done.
+func (c *FailoverClient) SearchContext(ctx context.Context, searchRequest *SearchRequest) (*SearchResult, error) {
+	var result *SearchResult
+	err := c.retry(ctx, func(conn *Conn) error {
+		var err error
+		result, err = conn.SearchContext(ctx, searchRequest)
+		return err
+	})
+	return result, err
+}
+
+// Compare checks to see if the attribute of the dn matches value, failing
+// over to the next server and retrying on network errors.
+func (c *FailoverClient) Compare(dn, attribute, value string) (bool, error) {
+	return c.CompareContext(context.Background(), dn, attribute, value)
+}
+
+// CompareContext is like Compare, but stops retrying and abandons the
+// request when ctx is done.
+func (c *FailoverClient) CompareContext(ctx context.Context, dn, attribute, value string) (bool, error) {
+	var matched bool
+	err := c.retry(ctx, func(conn *Conn) error {
+		var err error
+		matched, err = conn.CompareContext(ctx, dn, attribute, value)
+		return err
+	})
+	return matched, err
+}
+
+// Add performs the given add request. It is not retried.
+func (c *FailoverClient) Add(addRequest *AddRequest) error {
+	return c.AddContext(context.Background(), addRequest)
+}
+
+// AddContext is like Add, but abandons the request when ctx is done.
+func (c *FailoverClient) AddContext(ctx context.Context, addRequest *AddRequest) error {
+	return c.do(ctx, func(conn *Conn) error {
+		return conn.AddContext(ctx, addRequest)
+	})
+}
+
+// Modify performs the given modify request. It is not retried.
+func (c *FailoverClient) Modify(modifyRequest *ModifyRequest) error {
+	return c.ModifyContext(context.Background(), modifyRequest)
+}
+
+// ModifyContext is like Modify, but abandons the request when ctx is done.
+func (c *FailoverClient) ModifyContext(ctx context.Context, modifyRequest *ModifyRequest) error {
+	return c.do(ctx, func(conn *Conn) error {
+		return conn.ModifyContext(ctx, modifyRequest)
+	})
+}
+
+// Del performs the given delete request. It is not retried.
+func (c *FailoverClient) Del(delRequest *DelRequest) error {
+	return c.DelContext(context.Background(), delRequest)
+}
+
+// DelContext is like Del, but abandons the request when ctx is done.
+func (c *FailoverClient) DelContext(ctx context.Context, delRequest *DelRequest) error {
+	return c.do(ctx, func(conn *Conn) error {
+		return conn.DelContext(ctx, delRequest)
+	})
+}
+
+// ModifyDN performs the given modify DN request. It is not retried.
+func (c *FailoverClient) ModifyDN(modifyDNRequest *ModifyDNRequest) error {
+	return c.ModifyDNContext(context.Background(), modifyDNRequest)
+}
+
+// ModifyDNContext is like ModifyDN, but abandons the request when ctx is
+// done.
+func (c *FailoverClient) ModifyDNContext(ctx context.Context, modifyDNRequest *ModifyDNRequest) error {
+	return c.do(ctx, func(conn *Conn) error {
+		return conn.ModifyDNContext(ctx, modifyDNRequest)
+	})
+}
+
+// do runs op once on the current connection, dropping the connection if op
+// fails because of it.
+func (c *FailoverClient) do(ctx context.Context, op func(*Conn) error) error {
+	_, err := c.try(ctx, op)
+	return err
+}
+
+// try runs op once on the current connection. It reports whether the
+// connection failed, in which case it is dropped: a network error, or any
+// error once the connection is closed, e.g. by a notice of disconnection
+// that carries the server's result code.
+func (c *FailoverClient) try(ctx context.Context, op func(*Conn) error) (failed bool, err error) {
+	conn, err := c.Conn(ctx)
+	if err != nil {
+		return IsErrorWithCode(err, ErrorNetwork), err
+	}
+	err = op(conn)
+	if err != nil && (IsErrorWithCode(err, ErrorNetwork) || conn.Err() != nil) {
+		c.drop(conn)
+		return true, err
+	}
+	return false, err
+}
+
+// retry runs op until it succeeds, fails for another reason than a failed
+// connection, or the retry policy gives up.
+func (c *FailoverClient) retry(ctx context.Context, op func(*Conn) error) error {
+	backoff := c.config.Retry.Backoff
+
+	for attempt := 1; ; attempt++ {
+		failed, err := c.try(ctx, op)
+		if !failed || attempt >= c.maxAttempts() {
+			return err
+		}
+
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return NewError(ErrorCanceled, ctx.Err())
+			}
+			backoff *= 2
+			if c.config.Retry.MaxBackoff > 0 && backoff > c.config.Retry.MaxBackoff {
+				backoff = c.config.Retry.MaxBackoff
+			}
+		}
+	}
+}
+
+// maxAttempts returns the number of attempts allowed by the retry policy.
+func (c *FailoverClient) maxAttempts() int {
+	attempts := c.config.Retry.MaxAttempts
+	if attempts == 0 {
+		c.mu.Lock()
+		attempts = c.servers
+		c.mu.Unlock()
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	return attempts
+}
+
+// drop closes conn if it is still the current connection.
+func (c *FailoverClient) drop(conn *Conn) {
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn, c.url = nil, ""
+	}
+	c.mu.Unlock()
+	conn.Close()
+}
+
+// connect dials addr and sets up the connection as configured.
+func (c *FailoverClient) connect(ctx context.Context, addr string) (*Conn, error) {
+	u, err := ParseLDAPURL(addr)
+	if err != nil {
+		return nil, NewError(ErrorNetwork, err)
+	}
+	tlsConfig := &tls.Config{}
+	if c.config.TLSConfig != nil {
+		tlsConfig = c.config.TLSConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" && u.Scheme != "ldapi" {
+		tlsConfig.ServerName = strings.Trim(hostWithoutPort(u.Host), "[]")
+	}
+
+	opts := append([]DialOpt{DialWithTLSConfig(tlsConfig)}, c.config.DialOpts...)
+	conn, err := DialURL(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "ldap" && c.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	switch {
+	case c.config.Bind != nil:
+		err = c.config.Bind(conn)
+	case c.config.BindDN != "" || c.config.BindPassword != "":
+		err = conn.BindContext(ctx, c.config.BindDN, c.config.BindPassword)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,274 @@
+package ldap
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// testServer is a TCP server that passes the requests of every connection
+// to handle. handle returns false to drop the connection.
+type testServer struct {
+	listener net.Listener
+	handle   func(conn int, request *ber.Packet, server net.Conn) bool
+
+	mu    sync.Mutex
+	conns int
+	binds int
+}
+
+func newTestServer(t *testing.T, handle func(conn int, request *ber.Packet, server net.Conn) bool) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{listener: listener, handle: handle}
+	go func() {
+		for {
+			server, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			n := s.conns
+			s.mu.Unlock()
+			go s.serve(n, server)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) serve(n int, server net.Conn) {
+	defer server.Close()
+	for request := range readRequests(server) {
+		if request.Children[1].Tag == ApplicationBindRequest {
+			s.mu.Lock()
+			s.binds++
+			s.mu.Unlock()
+			writeResponse(nil, server, request.Children[0].Value.(int64), newResult(ApplicationBindResponse, LDAPResultSuccess, ""))
+			continue
+		}
+		if !s.handle(n, request, server) {
+			return
+		}
+	}
+}
+
+func (s *testServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testServer) stats() (conns, binds int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns, s.binds
+}
+
+// closedURL returns the URL of a port nothing listens on.
+func closedURL(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return "ldap://" + listener.Addr().String()
+}
+
+func answerSearch(request *ber.Packet, server net.Conn) {
+	messageID := request.Children[0].Value.(int64)
+	writeResponse(nil, server, messageID, newSearchEntry("cn=test,dc=example,dc=com", "cn", "test"))
+	writeResponse(nil, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+}
+
+func TestFailoverClientSearch(t *testing.T) {
+	s := newTestServer(t, func(conn int, request *ber.Packet, server net.Conn) bool {
+		// the first connection dies on its first search
+		if conn == 1 {
+			return false
+		}
+		answerSearch(request, server)
+		return true
+	})
+	defer s.listener.Close()
+
+	c, err := NewFailoverClient(FailoverConfig{
+		URLs:         []string{closedURL(t), s.url()},
+		BindDN:       "cn=admin,dc=example,dc=com",
+		BindPassword: "secret",
+		Retry:        RetryPolicy{MaxAttempts: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	result, err := c.Search(NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(cn=test)", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].DN != "cn=test,dc=example,dc=com" {
+		t.Errorf("unexpected entries %v", result.Entries)
+	}
+	if c.URL() != s.url() {
+		t.Errorf("expected to be connected to %s, got %s", s.url(), c.URL())
+	}
+	if conns, binds := s.stats(); conns != 2 || binds != 2 {
+		t.Errorf("expected 2 connections and binds, got %d and %d", conns, binds)
+	}
+}
+
+func TestFailoverClientNoRetry(t *testing.T) {
+	s := newTestServer(t, func(conn int, request *ber.Packet, server net.Conn) bool {
+		if request.Children[1].Tag == ApplicationAddRequest {
+			return false
+		}
+		answerSearch(request, server)
+		return true
+	})
+	defer s.listener.Close()
+
+	c, err := NewFailoverClient(FailoverConfig{URLs: []string{s.url()}, Retry: RetryPolicy{MaxAttempts: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Add(NewAddRequest("cn=test,dc=example,dc=com", nil)); !IsErrorWithCode(err, ErrorNetwork) {
+		t.Errorf("expected a network error, got %v", err)
+	}
+	if conns, _ := s.stats(); conns != 1 {
+		t.Errorf("expected the add not to be retried, got %d connections", conns)
+	}
+
+	if _, err := c.Search(NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(cn=test)", nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if conns, _ := s.stats(); conns != 2 {
+		t.Errorf("expected a reconnect, got %d connections", conns)
+	}
+}
+
+func TestFailoverClientNoticeOfDisconnection(t *testing.T) {
+	s := newTestServer(t, func(conn int, request *ber.Packet, server net.Conn) bool {
+		// the first connection is shut down by the server on its first
+		// search, without closing it
+		if conn == 1 {
+			writeResponse(nil, server, 0, newNotification(LDAPResultUnavailable, "shutting down", NoticeOfDisconnectionOID))
+			return true
+		}
+		if request.Children[1].Tag == ApplicationAddRequest {
+			writeResponse(nil, server, 0, newNotification(LDAPResultUnavailable, "shutting down", NoticeOfDisconnectionOID))
+			return true
+		}
+		answerSearch(request, server)
+		return true
+	})
+	defer s.listener.Close()
+
+	c, err := NewFailoverClient(FailoverConfig{URLs: []string{s.url()}, Retry: RetryPolicy{MaxAttempts: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	searchRequest := NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(cn=test)", nil, nil)
+	result, err := c.Search(searchRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 1 {
+		t.Errorf("unexpected entries %v", result.Entries)
+	}
+	if conns, _ := s.stats(); conns != 2 {
+		t.Errorf("expected the search to be retried on a new connection, got %d connections", conns)
+	}
+
+	// An add is not retried, but its connection is replaced
+	if err := c.Add(NewAddRequest("cn=test,dc=example,dc=com", nil)); !IsErrorWithCode(err, LDAPResultUnavailable) {
+		t.Errorf("expected LDAPResultUnavailable, got %v", err)
+	}
+	if _, err := c.Search(searchRequest); err != nil {
+		t.Fatal(err)
+	}
+	if conns, _ := s.stats(); conns != 3 {
+		t.Errorf("expected a reconnect after the add, got %d connections", conns)
+	}
+}
+
+func TestNewFailoverClientInvalidURL(t *testing.T) {
+	if _, err := NewFailoverClient(FailoverConfig{URLs: []string{"http://ldap.example.com"}}); err == nil {
+		t.Error("expected an error for an http:// URL")
+	}
+}
+
+func TestFailoverClientSlowBind(t *testing.T) {
+	s := newTestServer(t, func(conn int, request *ber.Packet, server net.Conn) bool {
+		answerSearch(request, server)
+		return true
+	})
+	defer s.listener.Close()
+
+	release := make(chan struct{})
+	binding := make(chan struct{})
+	c, err := NewFailoverClient(FailoverConfig{
+		URLs: []string{s.url()},
+		Bind: func(*Conn) error {
+			close(binding)
+			<-release
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := c.Search(NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(cn=test)", nil, nil))
+			done <- err
+		}()
+	}
+	<-binding
+
+	// URL does not wait for the bind in progress
+	urlDone := make(chan string)
+	go func() {
+		urlDone <- c.URL()
+	}()
+	select {
+	case url := <-urlDone:
+		if url != "" {
+			t.Errorf("expected no URL while connecting, got %s", url)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("URL blocked while a server was binding")
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conns, _ := s.stats(); conns != 1 {
+		t.Errorf("expected the searches to share one connection, got %d", conns)
+	}
+}
+
+func TestUniqueURLs(t *testing.T) {
+	urls := uniqueURLs(
+		[]string{"ldap://ldap1.example.com:389", "ldaps://ldap1.example.com:636", "ldap://ldap2.example.com:3389"},
+		[]string{"ldap://LDAP1.example.com", "ldaps://ldap1.example.com", "ldap://ldap2.example.com", "ldapi://%2Fvar%2Frun%2Fldapi"},
+	)
+	want := []string{"ldap://ldap1.example.com:389", "ldaps://ldap1.example.com:636", "ldap://ldap2.example.com:3389", "ldap://ldap2.example.com", "ldapi://%2Fvar%2Frun%2Fldapi"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("got %q, expected %q", urls, want)
+	}
+}
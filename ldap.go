@@ -35,6 +35,7 @@ const (
 	ApplicationSearchResultReference = 19
 	ApplicationExtendedRequest       = 23
 	ApplicationExtendedResponse      = 24
+	ApplicationIntermediateResponse  = 25
 )
 
 var ApplicationMap = map[uint8]string{
@@ -58,6 +59,7 @@ var ApplicationMap = map[uint8]string{
 	ApplicationSearchResultReference: "Search Result Reference",
 	ApplicationExtendedRequest:       "Extended Request",
 	ApplicationExtendedResponse:      "Extended Response",
+	ApplicationIntermediateResponse:  "Intermediate Response",
 }
 
 // LDAP Result Codes
@@ -101,6 +103,13 @@ const (
 	LDAPResultObjectClassModsProhibited    = 69
 	LDAPResultAffectsMultipleDSAs          = 71
 	LDAPResultOther                        = 80
+	LDAPResultCanceled                     = 118
+	LDAPResultNoSuchOperation              = 119
+	LDAPResultTooLate                      = 120
+	LDAPResultCannotCancel                 = 121
+
+	// Content Synchronization Operation -- RFC 4533
+	LDAPResultSyncRefreshRequired = 4096
 
 	ErrorNetwork            = 200
 	ErrorFilterCompile      = 201
@@ -108,9 +117,11 @@ const (
 	ErrorDebugging          = 203
 	ErrorUnexpectedMessage  = 204
 	ErrorUnexpectedResponse = 205
+	ErrorCanceled           = 206
+	ErrorReferralLimit      = 207
 )
 
-var LDAPResultCodeMap = map[uint8]string{
+var LDAPResultCodeMap = map[uint16]string{
 	LDAPResultSuccess:                      "Success",
 	LDAPResultOperationsError:              "Operations Error",
 	LDAPResultProtocolError:                "Protocol Error",
@@ -150,6 +161,11 @@ var LDAPResultCodeMap = map[uint8]string{
 	LDAPResultObjectClassModsProhibited:    "Object Class Mods Prohibited",
 	LDAPResultAffectsMultipleDSAs:          "Affects Multiple DSAs",
 	LDAPResultOther:                        "Other",
+	LDAPResultCanceled:                     "Canceled",
+	LDAPResultNoSuchOperation:              "No Such Operation",
+	LDAPResultTooLate:                      "Too Late",
+	LDAPResultCannotCancel:                 "Cannot Cancel",
+	LDAPResultSyncRefreshRequired:          "Sync Refresh Required",
 }
 
 // Ldap Behera Password Policy Draft 10 (https://tools.ietf.org/html/draft-behera-ldap-password-policy-10)
@@ -221,12 +237,15 @@ func addLDAPDescriptions(packet *ber.Packet) (err error) {
 	case ApplicationAddRequest:
 		addRequestDescriptions(packet)
 	case ApplicationAddResponse:
+		addDefaultLDAPResponseDescriptions(packet)
 	case ApplicationDelRequest:
 		addRequestDescriptions(packet)
 	case ApplicationDelResponse:
+		addDefaultLDAPResponseDescriptions(packet)
 	case ApplicationModifyDNRequest:
 		addRequestDescriptions(packet)
 	case ApplicationModifyDNResponse:
+		addDefaultLDAPResponseDescriptions(packet)
 	case ApplicationCompareRequest:
 		addRequestDescriptions(packet)
 	case ApplicationCompareResponse:
@@ -236,6 +255,7 @@ func addLDAPDescriptions(packet *ber.Packet) (err error) {
 	case ApplicationExtendedRequest:
 		addRequestDescriptions(packet)
 	case ApplicationExtendedResponse:
+	case ApplicationIntermediateResponse:
 	}
 
 	return nil
@@ -280,9 +300,8 @@ func addControlDescriptions(packet *ber.Packet) {
 				if child.Tag == 0 {
 					//Warning
 					child := child.Children[0]
-					packet := ber.DecodePacket(child.Data.Bytes())
-					val, ok := packet.Value.(int64)
-					if ok {
+					val, err := ber.ParseInt64(child.Data.Bytes())
+					if err == nil {
 						if child.Tag == 0 {
 							//timeBeforeExpiration
 							value.Description += " (TimeBeforeExpiration)"
@@ -295,13 +314,12 @@ func addControlDescriptions(packet *ber.Packet) {
 					}
 				} else if child.Tag == 1 {
 					// Error
-					packet := ber.DecodePacket(child.Data.Bytes())
-					val, ok := packet.Value.(int8)
-					if !ok {
+					val, err := ber.ParseInt64(child.Data.Bytes())
+					if err != nil {
 						val = -1
 					}
 					child.Description = "Error"
-					child.Value = val
+					child.Value = int8(val)
 				}
 			}
 		}
@@ -319,11 +337,15 @@ func addRequestDescriptions(packet *ber.Packet) {
 
 func addDefaultLDAPResponseDescriptions(packet *ber.Packet) {
 	resultCode := packet.Children[1].Children[0].Value.(int64)
-	packet.Children[1].Children[0].Description = "Result Code (" + LDAPResultCodeMap[uint8(resultCode)] + ")"
+	packet.Children[1].Children[0].Description = "Result Code (" + LDAPResultCodeMap[uint16(resultCode)] + ")"
 	packet.Children[1].Children[1].Description = "Matched DN"
 	packet.Children[1].Children[2].Description = "Error Message"
 	if len(packet.Children[1].Children) > 3 {
-		packet.Children[1].Children[3].Description = "Referral"
+		if packet.Children[1].Children[3].Tag == 7 {
+			packet.Children[1].Children[3].Description = "Server SASL Credentials"
+		} else {
+			packet.Children[1].Children[3].Description = "Referral"
+		}
 	}
 	if len(packet.Children) == 3 {
 		addControlDescriptions(packet.Children[2])
@@ -343,24 +365,79 @@ func DebugBinaryFile(fileName string) error {
 	return nil
 }
 
+// Error is the error returned for failed operations. ResultCode is an LDAP
+// result code or one of the Error* codes of this package; it is a uint16
+// as some result codes, e.g. LDAPResultSyncRefreshRequired, do not fit
+// into a byte.
 type Error struct {
 	Err        error
-	ResultCode uint8
+	ResultCode uint16
+	// Referrals holds the URLs sent by the server with an
+	// LDAPResultReferral result.
+	Referrals []string
 }
 
 func (e *Error) Error() string {
 	return fmt.Sprintf("LDAP Result Code %d %q: %s", e.ResultCode, LDAPResultCodeMap[e.ResultCode], e.Err.Error())
 }
 
-func NewError(resultCode uint8, err error) error {
+// Unwrap returns the underlying error, so that errors.Is and errors.As can
+// look through an *Error, e.g. to test for context.DeadlineExceeded.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func NewError(resultCode uint16, err error) error {
 	return &Error{ResultCode: resultCode, Err: err}
 }
 
-func getLDAPResultCode(packet *ber.Packet) (code uint8, description string) {
+// IsErrorWithCode returns true if err is or wraps an *Error with the given
+// result code, e.g. ErrorCanceled for an abandoned operation or
+// LDAPResultCanceled for one canceled by the server.
+func IsErrorWithCode(err error, desiredResultCode uint16) bool {
+	var serverError *Error
+	if !errors.As(err, &serverError) {
+		return false
+	}
+
+	return serverError.ResultCode == desiredResultCode
+}
+
+// newResultError returns the error for a non-successful LDAPResult in
+// packet, including the referral URLs it carries.
+func newResultError(packet *ber.Packet, resultCode uint16, description string) error {
+	return &Error{ResultCode: resultCode, Err: errors.New(description), Referrals: getReferrals(packet)}
+}
+
+// getReferrals returns the URLs of the referral field of the LDAPResult in
+// packet.
+//
+//	Referral ::= SEQUENCE SIZE (1..MAX) OF uri URI
+func getReferrals(packet *ber.Packet) []string {
+	if len(packet.Children) < 2 {
+		return nil
+	}
+	var referrals []string
+	for _, child := range packet.Children[1].Children {
+		if child.ClassType != ber.ClassContext || child.Tag != 3 {
+			continue
+		}
+		for _, uri := range child.Children {
+			if referral, ok := uri.Value.(string); ok {
+				referrals = append(referrals, referral)
+			} else {
+				referrals = append(referrals, uri.Data.String())
+			}
+		}
+	}
+	return referrals
+}
+
+func getLDAPResultCode(packet *ber.Packet) (code uint16, description string) {
 	if len(packet.Children) >= 2 {
 		response := packet.Children[1]
 		if response.ClassType == ber.ClassApplication && response.TagType == ber.TypeConstructed && len(response.Children) >= 3 {
-			return uint8(response.Children[0].Value.(int64)), response.Children[2].Value.(string)
+			return uint16(response.Children[0].Value.(int64)), response.Children[2].Value.(string)
 		}
 	}
 
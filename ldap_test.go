@@ -2,6 +2,7 @@ package ldap
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -225,6 +226,19 @@ func TestEscapeFilter(t *testing.T) {
 	}
 }
 
+func TestIsErrorWithCode(t *testing.T) {
+	err := fmt.Errorf("adding entry: %w", NewError(LDAPResultEntryAlreadyExists, errors.New("exists")))
+	if !IsErrorWithCode(err, LDAPResultEntryAlreadyExists) {
+		t.Errorf("wrapped error %v does not match its result code", err)
+	}
+	if IsErrorWithCode(err, LDAPResultNoSuchObject) {
+		t.Errorf("wrapped error %v matches another result code", err)
+	}
+	if IsErrorWithCode(nil, LDAPResultSuccess) || IsErrorWithCode(errors.New("other"), LDAPResultSuccess) {
+		t.Error("an error that is not an *Error matches")
+	}
+}
+
 func TestCompare(t *testing.T) {
 	fmt.Printf("TestCompare: starting...\n")
 	l, err := Dial("tcp", fmt.Sprintf("%s:%d", ldapServer, ldapPort))
@@ -0,0 +1,120 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+//
+// File contains Modify DN functionality
+//
+// https://tools.ietf.org/html/rfc4511
+//
+// ModifyDNRequest ::= [APPLICATION 12] SEQUENCE {
+//      entry           LDAPDN,
+//      newrdn          RelativeLDAPDN,
+//      deleteoldrdn    BOOLEAN,
+//      newSuperior     [0] LDAPDN OPTIONAL }
+//
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+type ModifyDNRequest struct {
+	DN           string
+	NewRDN       string
+	DeleteOldRDN bool
+	NewSuperior  string
+	Controls     []Control
+}
+
+// NewModifyDNRequest creates a request to rename and/or move the entry dn.
+//
+// rdn is the new relative name of the entry, e.g. "cn=Jane Doe". When
+// delOld is true the attribute values of the old RDN are removed from the
+// entry, otherwise they are kept as ordinary attribute values.
+//
+// newSup, when not empty, is the DN of the new parent the entry is moved
+// below. To move an entry without renaming it, pass its current RDN.
+func NewModifyDNRequest(dn string, rdn string, delOld bool, newSup string, controls []Control) *ModifyDNRequest {
+	return &ModifyDNRequest{
+		DN:           dn,
+		NewRDN:       rdn,
+		DeleteOldRDN: delOld,
+		NewSuperior:  newSup,
+		Controls:     controls,
+	}
+}
+
+func (m ModifyDNRequest) encode() *ber.Packet {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationModifyDNRequest, nil, "Modify DN Request")
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, m.DN, "DN"))
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, m.NewRDN, "New RDN"))
+	request.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, m.DeleteOldRDN, "Delete old RDN"))
+	if m.NewSuperior != "" {
+		request.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, m.NewSuperior, "New Superior"))
+	}
+	return request
+}
+
+// ModifyDN renames and/or moves an entry. Unlike a delete followed by an
+// add, the entry keeps its operational attributes such as entryUUID or
+// objectGUID.
+func (l *Conn) ModifyDN(modifyDNRequest *ModifyDNRequest) error {
+	return l.ModifyDNContext(context.Background(), modifyDNRequest)
+}
+
+// ModifyDNContext is like ModifyDN, but gives up waiting for the response
+// and abandons the request when ctx is done.
+func (l *Conn) ModifyDNContext(ctx context.Context, modifyDNRequest *ModifyDNRequest) error {
+	messageID := l.nextMessageID()
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(modifyDNRequest.encode())
+	if len(modifyDNRequest.Controls) > 0 {
+		packet.AppendChild(encodeControls(modifyDNRequest.Controls))
+	}
+
+	l.Debug.PrintPacket(packet)
+
+	channel, err := l.sendMessage(packet)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return NewError(ErrorNetwork, errors.New("ldap: could not send message"))
+	}
+	defer l.finishMessage(messageID)
+
+	l.Debug.Printf("%d: waiting for response", messageID)
+	packet, err = l.readPacket(ctx, messageID, channel)
+	if err != nil {
+		return err
+	}
+	l.Debug.Printf("%d: got response %p", messageID, packet)
+	if packet == nil {
+		return NewError(ErrorNetwork, errors.New("ldap: could not retrieve message"))
+	}
+
+	if l.Debug {
+		if err := addLDAPDescriptions(packet); err != nil {
+			return err
+		}
+		ber.PrintPacket(packet)
+	}
+
+	if packet.Children[1].Tag == ApplicationModifyDNResponse {
+		resultCode, resultDescription := getLDAPResultCode(packet)
+		if resultCode != 0 {
+			return newResultError(packet, resultCode, resultDescription)
+		}
+	} else {
+		return NewError(ErrorUnexpectedResponse, fmt.Errorf("Unexpected Response: %d", packet.Children[1].Tag))
+	}
+
+	l.Debug.Printf("%d: returning", messageID)
+	return nil
+}
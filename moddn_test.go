@@ -0,0 +1,61 @@
+package ldap
+
+import (
+	"testing"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+func TestModifyDN(t *testing.T) {
+	tests := []struct {
+		name        string
+		request     *ModifyDNRequest
+		newSuperior string
+	}{
+		{"rename", NewModifyDNRequest("cn=a,dc=example,dc=com", "cn=b", true, "", nil), ""},
+		{"move", NewModifyDNRequest("cn=a,dc=example,dc=com", "cn=a", false, "ou=people,dc=example,dc=com", nil), "ou=people,dc=example,dc=com"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, server := newPipeConn()
+			defer l.Close()
+			defer server.Close()
+			requests := readRequests(server)
+
+			done := make(chan error)
+			go func() {
+				done <- l.ModifyDN(test.request)
+			}()
+
+			request := <-requests
+			modifyDN := request.Children[1]
+			if modifyDN.Tag != ApplicationModifyDNRequest {
+				t.Fatalf("unexpected request tag %d", modifyDN.Tag)
+			}
+			if dn := string(modifyDN.Children[0].Data.Bytes()); dn != test.request.DN {
+				t.Errorf("got DN %q, expected %q", dn, test.request.DN)
+			}
+			if rdn := string(modifyDN.Children[1].Data.Bytes()); rdn != test.request.NewRDN {
+				t.Errorf("got new RDN %q, expected %q", rdn, test.request.NewRDN)
+			}
+			if deleteOld := modifyDN.Children[2].Value.(bool); deleteOld != test.request.DeleteOldRDN {
+				t.Errorf("got deleteoldrdn %v, expected %v", deleteOld, test.request.DeleteOldRDN)
+			}
+			newSuperior := ""
+			if len(modifyDN.Children) == 4 {
+				if child := modifyDN.Children[3]; child.ClassType != ber.ClassContext || child.Tag != 0 {
+					t.Errorf("unexpected newSuperior encoding %d/%d", child.ClassType, child.Tag)
+				}
+				newSuperior = string(modifyDN.Children[3].Data.Bytes())
+			}
+			if newSuperior != test.newSuperior {
+				t.Errorf("got newSuperior %q, expected %q", newSuperior, test.newSuperior)
+			}
+
+			writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationModifyDNResponse, LDAPResultSuccess, ""))
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
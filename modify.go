@@ -26,12 +26,23 @@
 //
 // AttributeValue ::= OCTET STRING
 //
+// AddRequest ::= [APPLICATION 8] SEQUENCE {
+//      entry           LDAPDN,
+//      attributes      AttributeList }
+//
+// AttributeList ::= SEQUENCE OF attribute Attribute
+//
+// Attribute ::= PartialAttribute(WITH COMPONENTS {
+//      ...,
+//      vals (SIZE(1..MAX))})
+//
 
 package ldap
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
 
 	"gopkg.in/asn1-ber.v1"
 )
@@ -42,16 +53,18 @@ const (
 	ReplaceAttribute = 2
 )
 
+// PartialAttribute is an attribute description with its values, as used
+// by add and modify requests.
 type PartialAttribute struct {
-	attrType string
-	attrVals []string
+	Type string
+	Vals []string
 }
 
 func (p *PartialAttribute) encode() *ber.Packet {
 	seq := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "PartialAttribute")
-	seq.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, p.attrType, "Type"))
+	seq.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, p.Type, "Type"))
 	set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "AttributeValue")
-	for _, value := range p.attrVals {
+	for _, value := range p.Vals {
 		set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Vals"))
 	}
 	seq.AppendChild(set)
@@ -66,15 +79,15 @@ type ModifyRequest struct {
 }
 
 func (m *ModifyRequest) Add(attrType string, attrVals []string) {
-	m.addAttributes = append(m.addAttributes, PartialAttribute{attrType: attrType, attrVals: attrVals})
+	m.addAttributes = append(m.addAttributes, PartialAttribute{Type: attrType, Vals: attrVals})
 }
 
 func (m *ModifyRequest) Delete(attrType string, attrVals []string) {
-	m.deleteAttributes = append(m.deleteAttributes, PartialAttribute{attrType: attrType, attrVals: attrVals})
+	m.deleteAttributes = append(m.deleteAttributes, PartialAttribute{Type: attrType, Vals: attrVals})
 }
 
 func (m *ModifyRequest) Replace(attrType string, attrVals []string) {
-	m.replaceAttributes = append(m.replaceAttributes, PartialAttribute{attrType: attrType, attrVals: attrVals})
+	m.replaceAttributes = append(m.replaceAttributes, PartialAttribute{Type: attrType, Vals: attrVals})
 }
 
 func (m ModifyRequest) encode() *ber.Packet {
@@ -112,6 +125,12 @@ func NewModifyRequest(
 }
 
 func (l *Conn) Modify(modifyRequest *ModifyRequest) error {
+	return l.ModifyContext(context.Background(), modifyRequest)
+}
+
+// ModifyContext is like Modify, but gives up waiting for the response and
+// abandons the request when ctx is done.
+func (l *Conn) ModifyContext(ctx context.Context, modifyRequest *ModifyRequest) error {
 	messageID := l.nextMessageID()
 	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
 	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
@@ -129,7 +148,10 @@ func (l *Conn) Modify(modifyRequest *ModifyRequest) error {
 	defer l.finishMessage(messageID)
 
 	l.Debug.Printf("%d: waiting for response", messageID)
-	packet = <-channel
+	packet, err = l.readPacket(ctx, messageID, channel)
+	if err != nil {
+		return err
+	}
 	l.Debug.Printf("%d: got response %p", messageID, packet)
 	if packet == nil {
 		return NewError(ErrorNetwork, errors.New("ldap: could not retrieve message"))
@@ -145,10 +167,105 @@ func (l *Conn) Modify(modifyRequest *ModifyRequest) error {
 	if packet.Children[1].Tag == ApplicationModifyResponse {
 		resultCode, resultDescription := getLDAPResultCode(packet)
 		if resultCode != 0 {
-			return NewError(resultCode, errors.New(resultDescription))
+			return newResultError(packet, resultCode, resultDescription)
+		}
+	} else {
+		return NewError(ErrorUnexpectedResponse, fmt.Errorf("Unexpected Response: %d", packet.Children[1].Tag))
+	}
+
+	l.Debug.Printf("%d: returning", messageID)
+	return nil
+}
+
+// AddRequest is a request to add the entry DN with the given attributes,
+// see NewAddRequest.
+type AddRequest struct {
+	DN         string
+	Attributes []PartialAttribute
+	Controls   []Control
+}
+
+// Attribute adds an attribute with the given values to the entry. An entry
+// must contain at least one value for every attribute being added.
+func (a *AddRequest) Attribute(attrType string, attrVals []string) {
+	a.Attributes = append(a.Attributes, PartialAttribute{Type: attrType, Vals: attrVals})
+}
+
+func (a AddRequest) encode() *ber.Packet {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationAddRequest, nil, "Add Request")
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, a.DN, "DN"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, attribute := range a.Attributes {
+		attributes.AppendChild(attribute.encode())
+	}
+	request.AppendChild(attributes)
+	return request
+}
+
+// NewAddRequest creates a request to add the entry dn. Attributes are
+// added to the request with AddRequest.Attribute.
+func NewAddRequest(
+	dn string,
+	controls []Control,
+) *AddRequest {
+	return &AddRequest{
+		DN:       dn,
+		Controls: controls,
+	}
+}
+
+// Add creates a new entry in the directory. The result code of the add
+// response is returned as an *Error when it is not LDAPResultSuccess.
+func (l *Conn) Add(addRequest *AddRequest) error {
+	return l.AddContext(context.Background(), addRequest)
+}
+
+// AddContext is like Add, but gives up waiting for the response and
+// abandons the request when ctx is done.
+func (l *Conn) AddContext(ctx context.Context, addRequest *AddRequest) error {
+	messageID := l.nextMessageID()
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(addRequest.encode())
+	if len(addRequest.Controls) > 0 {
+		packet.AppendChild(encodeControls(addRequest.Controls))
+	}
+
+	l.Debug.PrintPacket(packet)
+
+	channel, err := l.sendMessage(packet)
+	if err != nil {
+		return err
+	}
+	if channel == nil {
+		return NewError(ErrorNetwork, errors.New("ldap: could not send message"))
+	}
+	defer l.finishMessage(messageID)
+
+	l.Debug.Printf("%d: waiting for response", messageID)
+	packet, err = l.readPacket(ctx, messageID, channel)
+	if err != nil {
+		return err
+	}
+	l.Debug.Printf("%d: got response %p", messageID, packet)
+	if packet == nil {
+		return NewError(ErrorNetwork, errors.New("ldap: could not retrieve message"))
+	}
+
+	if l.Debug {
+		if err := addLDAPDescriptions(packet); err != nil {
+			return err
+		}
+		ber.PrintPacket(packet)
+	}
+
+	if packet.Children[1].Tag == ApplicationAddResponse {
+		resultCode, resultDescription := getLDAPResultCode(packet)
+		if resultCode != 0 {
+			return newResultError(packet, resultCode, resultDescription)
 		}
 	} else {
-		log.Printf("Unexpected Response: %d", packet.Children[1].Tag)
+		return NewError(ErrorUnexpectedResponse, fmt.Errorf("Unexpected Response: %d", packet.Children[1].Tag))
 	}
 
 	l.Debug.Printf("%d: returning", messageID)
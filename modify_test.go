@@ -0,0 +1,72 @@
+package ldap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	addRequest := NewAddRequest("cn=test,dc=example,dc=com", []Control{NewControlString("2.16.840.1.113730.3.4.2", true, "")})
+	addRequest.Attribute("objectClass", []string{"top", "person"})
+	addRequest.Attribute("cn", []string{"test"})
+	if last := addRequest.Attributes[1]; last.Type != "cn" || !reflect.DeepEqual(last.Vals, []string{"test"}) {
+		t.Errorf("unexpected attribute %+v", last)
+	}
+	done := make(chan error)
+	go func() {
+		done <- l.Add(addRequest)
+	}()
+
+	request := <-requests
+	add := request.Children[1]
+	if add.Tag != ApplicationAddRequest || string(add.Children[0].Data.Bytes()) != "cn=test,dc=example,dc=com" {
+		t.Fatalf("unexpected add request for %q", add.Children[0].Data.Bytes())
+	}
+	attributes := map[string][]string{}
+	for _, attribute := range add.Children[1].Children {
+		var values []string
+		for _, value := range attribute.Children[1].Children {
+			values = append(values, string(value.Data.Bytes()))
+		}
+		attributes[string(attribute.Children[0].Data.Bytes())] = values
+	}
+	if want := map[string][]string{"objectClass": {"top", "person"}, "cn": {"test"}}; !reflect.DeepEqual(attributes, want) {
+		t.Errorf("got attributes %q, expected %q", attributes, want)
+	}
+	if len(request.Children) != 3 || DecodeControl(request.Children[2].Children[0]).GetControlType() != "2.16.840.1.113730.3.4.2" {
+		t.Error("expected the ManageDsaIT control with the request")
+	}
+
+	writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationAddResponse, LDAPResultEntryAlreadyExists, "exists"))
+	if err := <-done; !IsErrorWithCode(err, LDAPResultEntryAlreadyExists) {
+		t.Fatalf("expected LDAPResultEntryAlreadyExists, got %v", err)
+	}
+}
+
+func TestModifyUnexpectedResponse(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	modifyRequest := NewModifyRequest("cn=test,dc=example,dc=com")
+	modifyRequest.Replace("sn", []string{"test"})
+	done := make(chan error)
+	go func() {
+		done <- l.Modify(modifyRequest)
+	}()
+
+	request := <-requests
+	if request.Children[1].Tag != ApplicationModifyRequest {
+		t.Fatalf("expected a modify request, got tag %d", request.Children[1].Tag)
+	}
+	writeResponse(t, server, request.Children[0].Value.(int64), newResult(ApplicationAddResponse, LDAPResultSuccess, ""))
+	if err := <-done; !IsErrorWithCode(err, ErrorUnexpectedResponse) {
+		t.Fatalf("expected ErrorUnexpectedResponse, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+)
+
+// PagedSearch is a handle on a search that uses the simple paged results
+// control (RFC 2696) to read the results one page at a time.
+type PagedSearch struct {
+	conn    *Conn
+	ctx     context.Context
+	request SearchRequest
+	paging  *ControlPaging
+
+	page          *SearchResult
+	estimatedSize uint32
+	err           error
+	done          bool
+	more          bool // the server holds more pages for the cookie
+	closed        bool
+}
+
+// PagedSearch returns a handle that reads the results of searchRequest in
+// pages of at most pagingSize entries. No request is sent before the first
+// call to Next. searchRequest is not modified: the paging control is added
+// to a copy of it, replacing any paging control the caller included.
+//
+//	paged := l.PagedSearch(ctx, searchRequest, 500)
+//	defer paged.Close()
+//	for paged.Next() {
+//		for _, entry := range paged.Page().Entries {
+//			...
+//		}
+//	}
+//	if err := paged.Err(); err != nil {
+//		...
+//	}
+func (l *Conn) PagedSearch(ctx context.Context, searchRequest *SearchRequest, pagingSize uint32) *PagedSearch {
+	p := &PagedSearch{
+		conn:    l,
+		ctx:     ctx,
+		request: *searchRequest,
+		paging:  NewControlPaging(pagingSize),
+	}
+	p.request.Controls = make([]Control, 0, len(searchRequest.Controls)+1)
+	for _, control := range searchRequest.Controls {
+		if control.GetControlType() != ControlTypePaging {
+			p.request.Controls = append(p.request.Controls, control)
+		}
+	}
+	p.request.Controls = append(p.request.Controls, p.paging)
+	return p
+}
+
+// Next requests the next page of results. It returns false when there are
+// no more pages or the request failed, in which case Err returns the error.
+func (p *PagedSearch) Next() bool {
+	if p.done {
+		return false
+	}
+
+	l := p.conn
+	result, err := l.SearchContext(p.ctx, &p.request)
+	if err != nil {
+		// Unless the request was abandoned, the server is done with the
+		// cookie after answering it
+		p.err, p.done = err, true
+		p.more = p.more && IsErrorWithCode(err, ErrorCanceled)
+		return false
+	}
+	if result == nil {
+		p.err, p.done = NewError(ErrorNetwork, errors.New("ldap: packet not received")), true
+		return false
+	}
+	p.page = result
+
+	l.Debug.Printf("Looking for Paging Control...")
+	pagingResult, ok := FindControl(result.Controls, ControlTypePaging).(*ControlPaging)
+	if !ok {
+		l.Debug.Printf("Could not find paging control.  Breaking...")
+		p.done, p.more = true, false
+		return true
+	}
+	p.estimatedSize = pagingResult.PagingSize
+
+	if len(pagingResult.Cookie) == 0 {
+		l.Debug.Printf("Could not find cookie.  Breaking...")
+		p.done, p.more = true, false
+		return true
+	}
+	p.paging.SetCookie(pagingResult.Cookie)
+	p.more = true
+	return true
+}
+
+// Page returns the page of results read by the last call to Next.
+func (p *PagedSearch) Page() *SearchResult {
+	return p.page
+}
+
+// EstimatedSize returns the server's estimate of the total number of
+// entries in the result set, as sent with the last page. It is 0 if the
+// server does not know or did not tell.
+func (p *PagedSearch) EstimatedSize() uint32 {
+	return p.estimatedSize
+}
+
+// Err returns the error that ended the paged search, if any.
+func (p *PagedSearch) Err() error {
+	return p.err
+}
+
+// Close stops the paged search. If the server still holds more pages, it is
+// told to discard them by a final request with a page size of 0, as
+// described in RFC 2696. That request is sent even if the context of the
+// paged search is done, e.g. after Next failed because it was canceled, and
+// is only bounded by the request timeout of the connection.
+func (p *PagedSearch) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed, p.done = true, true
+	if !p.more {
+		return nil
+	}
+	p.more = false
+
+	p.conn.Debug.Printf("Abandoning Paging...")
+	p.paging.PagingSize = 0
+	_, err := p.conn.SearchContext(context.Background(), &p.request)
+	return err
+}
@@ -6,6 +6,7 @@
 package ldap
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -73,6 +74,12 @@ func NewPasswordModifyRequest(userIdentity string, oldPassword string, newPasswo
 }
 
 func (l *Conn) PasswordModify(passwordModifyRequest *PasswordModifyRequest) (*PasswordModifyResult, error) {
+	return l.PasswordModifyContext(context.Background(), passwordModifyRequest)
+}
+
+// PasswordModifyContext is like PasswordModify, but gives up waiting for the
+// response and abandons the request when ctx is done.
+func (l *Conn) PasswordModifyContext(ctx context.Context, passwordModifyRequest *PasswordModifyRequest) (*PasswordModifyResult, error) {
 	messageID := l.nextMessageID()
 
 	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
@@ -98,7 +105,10 @@ func (l *Conn) PasswordModify(passwordModifyRequest *PasswordModifyRequest) (*Pa
 	result := &PasswordModifyResult{}
 
 	l.Debug.Printf("%d: waiting for response", messageID)
-	packet = <-channel
+	packet, err = l.readPacket(ctx, messageID, channel)
+	if err != nil {
+		return nil, err
+	}
 	l.Debug.Printf("%d: got response %p", messageID, packet)
 
 	if packet == nil {
@@ -0,0 +1,326 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PoolConfig configures a Pool.
+type PoolConfig struct {
+	// Network and Addr are passed to Dial, or to DialTLS if TLSConfig is
+	// set, to open new connections.
+	Network   string
+	Addr      string
+	TLSConfig *tls.Config
+
+	// DialOpts are passed to Dial or DialTLS.
+	DialOpts []DialOpt
+
+	// Dial, if set, is used instead to open new connections, e.g. to use
+	// StartTLS.
+	Dial func() (*Conn, error)
+
+	// BindDN and BindPassword are the credentials new connections are
+	// bound with. If both are empty, connections stay anonymous.
+	BindDN       string
+	BindPassword string
+
+	// Bind, if set, is used instead of BindDN and BindPassword to bind
+	// connections, e.g. to use a SASL mechanism.
+	Bind func(*Conn) error
+
+	// HealthCheck, if set, is called on an idle connection before it is
+	// handed out again. Connections for which it fails are closed.
+	HealthCheck func(*Conn) error
+
+	// MaxOpen limits the number of open connections, idle or in use. Get
+	// waits for a connection to be returned once the limit is reached.
+	// 0 means no limit.
+	MaxOpen int
+
+	// MaxIdle limits the number of idle connections kept open. 0 means
+	// the default of 2, a negative value means no idle connections.
+	MaxIdle int
+}
+
+// PoolStats describes the state of a Pool.
+type PoolStats struct {
+	MaxOpen int // Maximum number of open connections, 0 for no limit
+	Open    int // Number of open connections, idle and in use
+	InUse   int // Number of connections handed out
+	Idle    int // Number of idle connections
+
+	WaitCount    int64         // Number of Get calls that had to wait
+	WaitDuration time.Duration // Total time spent waiting
+	Dialed       int64         // Number of connections opened
+	Broken       int64         // Number of connections closed because they were dead or failed to bind
+}
+
+// Pool keeps bound connections for reuse. Its methods are safe for
+// concurrent use.
+type Pool struct {
+	config PoolConfig
+
+	mu      sync.Mutex
+	idle    []*pooledConn
+	inUse   map[*Conn]uint64
+	open    int
+	waiters []chan struct{}
+	closed  bool
+	stats   PoolStats
+}
+
+type pooledConn struct {
+	conn  *Conn
+	binds uint64
+}
+
+// NewPool returns a pool of connections configured by config. No
+// connection is opened until the first call to Get.
+func NewPool(config PoolConfig) *Pool {
+	return &Pool{
+		config: config,
+		inUse:  map[*Conn]uint64{},
+		stats:  PoolStats{MaxOpen: config.MaxOpen},
+	}
+}
+
+func (p *Pool) maxIdle() int {
+	switch {
+	case p.config.MaxIdle == 0:
+		return 2
+	case p.config.MaxIdle < 0:
+		return 0
+	}
+	return p.config.MaxIdle
+}
+
+// Get returns a bound connection, reusing an idle one if possible. The
+// connection must be given back with Put, or with Discard if it should not
+// be reused. Get waits until ctx is done if MaxOpen connections are in use.
+func (p *Pool) Get(ctx context.Context) (*Conn, error) {
+	var start time.Time
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, NewError(ErrorNetwork, errors.New("ldap: pool closed"))
+		}
+
+		if n := len(p.idle); n > 0 {
+			pc := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.inUse[pc.conn] = pc.binds
+			p.mu.Unlock()
+
+			if pc.conn.IsClosing() {
+				p.broken(pc.conn)
+				continue
+			}
+			if p.config.HealthCheck != nil {
+				if err := p.config.HealthCheck(pc.conn); err != nil {
+					pc.conn.Close()
+					p.broken(pc.conn)
+					continue
+				}
+			}
+			return pc.conn, nil
+		}
+
+		if p.config.MaxOpen <= 0 || p.open < p.config.MaxOpen {
+			p.open++
+			p.mu.Unlock()
+			return p.newConn()
+		}
+
+		wait := make(chan struct{})
+		p.waiters = append(p.waiters, wait)
+		if start.IsZero() {
+			start = time.Now()
+			p.stats.WaitCount++
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-wait:
+			p.mu.Lock()
+			p.stats.WaitDuration += time.Since(start)
+			start = time.Now()
+			p.mu.Unlock()
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.stats.WaitDuration += time.Since(start)
+			p.removeWaiter(wait)
+			p.mu.Unlock()
+			return nil, NewError(ErrorCanceled, ctx.Err())
+		}
+	}
+}
+
+// newConn dials and binds a connection for which a slot was reserved.
+func (p *Pool) newConn() (*Conn, error) {
+	conn, err := p.dial()
+	if err != nil {
+		p.mu.Lock()
+		p.open--
+		p.wakeWaiter()
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	if err := p.bind(conn); err != nil {
+		conn.Close()
+		p.mu.Lock()
+		p.open--
+		p.stats.Dialed++
+		p.stats.Broken++
+		p.wakeWaiter()
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.stats.Dialed++
+	p.inUse[conn] = conn.bindCount()
+	p.mu.Unlock()
+	return conn, nil
+}
+
+// Put gives a connection obtained from Get back to the pool. Connections
+// that were closed, e.g. by a network error, are dropped. If the caller
+// re-bound the connection, it is bound again with the pool credentials
+// before it is reused.
+func (p *Pool) Put(conn *Conn) {
+	p.mu.Lock()
+	binds, ok := p.inUse[conn]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if conn.IsClosing() {
+		p.broken(conn)
+		return
+	}
+	if conn.bindCount() != binds {
+		if err := p.bind(conn); err != nil {
+			conn.Close()
+			p.broken(conn)
+			return
+		}
+	}
+
+	p.mu.Lock()
+	delete(p.inUse, conn)
+	if p.closed || len(p.idle) >= p.maxIdle() {
+		p.open--
+		p.wakeWaiter()
+		p.mu.Unlock()
+		conn.Close()
+		return
+	}
+	p.idle = append(p.idle, &pooledConn{conn: conn, binds: conn.bindCount()})
+	p.wakeWaiter()
+	p.mu.Unlock()
+}
+
+// Discard closes a connection obtained from Get instead of giving it back,
+// e.g. after an error that leaves it in an unknown state.
+func (p *Pool) Discard(conn *Conn) {
+	p.mu.Lock()
+	_, ok := p.inUse[conn]
+	if ok {
+		delete(p.inUse, conn)
+		p.open--
+		p.wakeWaiter()
+	}
+	p.mu.Unlock()
+	if ok {
+		conn.Close()
+	}
+}
+
+// Close closes the idle connections. Connections in use are closed when
+// they are given back, and waiting Get calls fail.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
+	p.closed = true
+	for _, wait := range p.waiters {
+		close(wait)
+	}
+	p.waiters = nil
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		pc.conn.Close()
+	}
+}
+
+// Stats returns statistics about the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Open = p.open
+	stats.InUse = len(p.inUse)
+	stats.Idle = len(p.idle)
+	return stats
+}
+
+func (p *Pool) dial() (*Conn, error) {
+	if p.config.Dial != nil {
+		return p.config.Dial()
+	}
+	if p.config.TLSConfig != nil {
+		return DialTLS(p.config.Network, p.config.Addr, p.config.TLSConfig, p.config.DialOpts...)
+	}
+	return Dial(p.config.Network, p.config.Addr, p.config.DialOpts...)
+}
+
+func (p *Pool) bind(conn *Conn) error {
+	if p.config.Bind != nil {
+		return p.config.Bind(conn)
+	}
+	if p.config.BindDN == "" && p.config.BindPassword == "" {
+		return nil
+	}
+	return conn.Bind(p.config.BindDN, p.config.BindPassword)
+}
+
+// broken drops a dead connection handed out by Get.
+func (p *Pool) broken(conn *Conn) {
+	p.mu.Lock()
+	delete(p.inUse, conn)
+	p.open--
+	p.stats.Broken++
+	p.wakeWaiter()
+	p.mu.Unlock()
+}
+
+// wakeWaiter lets the longest waiting Get call retry. p.mu must be held.
+func (p *Pool) wakeWaiter() {
+	if len(p.waiters) == 0 {
+		return
+	}
+	close(p.waiters[0])
+	p.waiters = p.waiters[1:]
+}
+
+// removeWaiter forgets a Get call that gave up. If it was woken up in the
+// meantime, the wake up is passed on. p.mu must be held.
+func (p *Pool) removeWaiter(wait chan struct{}) {
+	for i, w := range p.waiters {
+		if w == wait {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return
+		}
+	}
+	p.wakeWaiter()
+}
@@ -0,0 +1,141 @@
+package ldap
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// poolServer answers every bind on pipe connections with success and
+// records the bound DNs.
+type poolServer struct {
+	mu      sync.Mutex
+	servers []net.Conn
+	binds   []string
+}
+
+func (s *poolServer) dial() (*Conn, error) {
+	l, server := newPipeConn()
+	s.mu.Lock()
+	s.servers = append(s.servers, server)
+	s.mu.Unlock()
+
+	go func() {
+		for request := range readRequests(server) {
+			if len(request.Children) < 2 || request.Children[1].Tag != ApplicationBindRequest {
+				continue
+			}
+			s.mu.Lock()
+			s.binds = append(s.binds, request.Children[1].Children[1].Value.(string))
+			s.mu.Unlock()
+			writeResponse(nil, server, request.Children[0].Value.(int64), newResult(ApplicationBindResponse, LDAPResultSuccess, ""))
+		}
+	}()
+	return l, nil
+}
+
+func (s *poolServer) boundDNs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+func TestPoolReuseAndRebind(t *testing.T) {
+	s := &poolServer{}
+	p := NewPool(PoolConfig{Dial: s.dial, BindDN: "cn=pool", BindPassword: "secret"})
+	defer p.Close()
+
+	l, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(l)
+
+	l2, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l2 != l {
+		t.Error("expected the idle connection to be reused")
+	}
+	if err := l2.Bind("cn=user", "password"); err != nil {
+		t.Fatal(err)
+	}
+	p.Put(l2)
+
+	expected := []string{"cn=pool", "cn=user", "cn=pool"}
+	if binds := s.boundDNs(); len(binds) != len(expected) || binds[0] != expected[0] || binds[1] != expected[1] || binds[2] != expected[2] {
+		t.Errorf("expected binds %v, got %v", expected, binds)
+	}
+	if stats := p.Stats(); stats.Open != 1 || stats.Idle != 1 || stats.Dialed != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPoolDeadConnection(t *testing.T) {
+	s := &poolServer{}
+	p := NewPool(PoolConfig{Dial: s.dial})
+	defer p.Close()
+
+	l, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(l)
+
+	// the reader goroutine exits once the server goes away
+	s.servers[0].Close()
+	for i := 0; !l.IsClosing(); i++ {
+		if i == 100 {
+			t.Fatal("connection not closed after the server went away")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	l2, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l2 == l {
+		t.Error("dead connection handed out")
+	}
+	if stats := p.Stats(); stats.Broken != 1 || stats.Dialed != 2 || stats.InUse != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	p.Discard(l2)
+}
+
+func TestPoolMaxOpen(t *testing.T) {
+	s := &poolServer{}
+	p := NewPool(PoolConfig{Dial: s.dial, MaxOpen: 1})
+	defer p.Close()
+
+	l, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); !IsErrorWithCode(err, ErrorCanceled) {
+		t.Errorf("expected ErrorCanceled, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		p.Put(l)
+	}()
+	l2, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l2 != l {
+		t.Error("expected the returned connection to be reused")
+	}
+	if stats := p.Stats(); stats.WaitCount != 2 || stats.Open != 1 || stats.MaxOpen != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	p.Put(l2)
+}
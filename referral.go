@@ -0,0 +1,354 @@
+// File contains referral chasing functionality
+//
+// https://tools.ietf.org/html/rfc4511#section-4.1.10
+// https://tools.ietf.org/html/rfc4511#section-4.5.3
+//
+//   Referral ::= SEQUENCE SIZE (1..MAX) OF uri URI
+//
+//   SearchResultReference ::= [APPLICATION 19] SEQUENCE
+//                             SIZE (1..MAX) OF uri URI
+//
+
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultReferralHopLimit is the number of referrals a ReferralChaser
+// follows in a row if HopLimit is not set.
+const DefaultReferralHopLimit = 10
+
+// ReferralChaser follows referrals returned for search and update
+// operations and the search result references returned by searches. The
+// zero value follows up to DefaultReferralHopLimit referrals in a row over
+// anonymous connections opened with DialURL.
+type ReferralChaser struct {
+	// Dial opens a connection to the server of a referral URL. If nil,
+	// DialURL is used.
+	Dial func(ctx context.Context, u *LDAPURL) (*Conn, error)
+
+	// TLSConfig is passed to DialURL for ldaps:// referrals if Dial is not
+	// set. If ServerName is not set, the host of the referral is used.
+	TLSConfig *tls.Config
+
+	// Origin is the URL of the server of the connection operations are
+	// sent on, e.g. "ldap://ldap1.example.com". Referrals to it use that
+	// connection, so loops back to it are detected right away. It defaults
+	// to the URL the connection was opened with by DialURL.
+	Origin string
+
+	// Bind binds the connections opened by Dial, e.g. with the credentials
+	// used on the original connection. If nil, they stay anonymous.
+	Bind func(ctx context.Context, conn *Conn, u *LDAPURL) error
+
+	// HopLimit limits the number of referrals followed in a row. 0 means
+	// DefaultReferralHopLimit.
+	HopLimit int
+
+	// SkipUnreachable keeps search result references that could not be
+	// followed in Referrals instead of failing the search.
+	SkipUnreachable bool
+}
+
+// ReferralSearchResult is the result of a search with referral chasing.
+// Referrals holds the search result references that were not followed and
+// Controls the controls of the original search result.
+type ReferralSearchResult struct {
+	SearchResult
+
+	// Servers holds the URL of the server that returned each entry in
+	// Entries, or "" for the connection the search was sent on.
+	Servers []string
+}
+
+// referralSession holds the state of one operation with referral
+// chasing. The original connection is the server "".
+type referralSession struct {
+	chaser  *ReferralChaser
+	origin  *Conn
+	conns   map[string]*Conn
+	visited map[string]bool
+}
+
+func (c *ReferralChaser) newSession(l *Conn) *referralSession {
+	return &referralSession{
+		chaser:  c,
+		origin:  l,
+		conns:   map[string]*Conn{},
+		visited: map[string]bool{},
+	}
+}
+
+// isOrigin returns true if key is the server of the original connection.
+func (s *referralSession) isOrigin(key string) bool {
+	origin := s.chaser.Origin
+	if origin == "" {
+		return key == s.origin.url
+	}
+	u, err := ParseLDAPURL(origin)
+	return err == nil && key == serverURL(u)
+}
+
+// close closes the connections opened to referred servers.
+func (s *referralSession) close() {
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *referralSession) hopLimit() int {
+	if s.chaser.HopLimit > 0 {
+		return s.chaser.HopLimit
+	}
+	return DefaultReferralHopLimit
+}
+
+// Search performs the given search request on l and follows the referrals
+// and search result references it returns.
+func (c *ReferralChaser) Search(ctx context.Context, l *Conn, searchRequest *SearchRequest) (*ReferralSearchResult, error) {
+	s := c.newSession(l)
+	defer s.close()
+
+	result := &ReferralSearchResult{}
+	s.visit("", searchRequest.BaseDN, searchRequest.Scope)
+	if err := s.search(ctx, l, "", searchRequest, result, 0); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *referralSession) search(ctx context.Context, l *Conn, server string, searchRequest *SearchRequest, result *ReferralSearchResult, hops int) error {
+	// Each search result reference is followed at one of its URLs
+	var references [][]string
+	sr, err := l.searchWithCallbacks(ctx, searchRequest, searchCallbacks{
+		referral: func(referrals []string) error {
+			references = append(references, referrals)
+			return nil
+		},
+	})
+	if err != nil {
+		if referrals := referralsOf(err); len(referrals) > 0 {
+			return s.followSearch(ctx, l, server, referrals, searchRequest, false, result, hops)
+		}
+		return err
+	}
+
+	if hops == 0 {
+		result.Controls = sr.Controls
+	}
+	for _, entry := range sr.Entries {
+		result.Entries = append(result.Entries, entry)
+		result.Servers = append(result.Servers, server)
+	}
+	for _, referrals := range references {
+		err := s.followSearch(ctx, l, server, referrals, searchRequest, true, result, hops)
+		if err != nil {
+			if !s.chaser.SkipUnreachable || IsErrorWithCode(err, ErrorCanceled) {
+				return err
+			}
+			result.Referrals = append(result.Referrals, referrals[0])
+		}
+	}
+	return nil
+}
+
+// followSearch continues a search at the first of the alternative referral
+// URLs that can be reached. Continuation references of a single level
+// search are searched with base scope.
+func (s *referralSession) followSearch(ctx context.Context, l *Conn, server string, referrals []string, searchRequest *SearchRequest, continuation bool, result *ReferralSearchResult, hops int) error {
+	if hops >= s.hopLimit() {
+		return NewError(ErrorReferralLimit, fmt.Errorf("ldap: referral hop limit of %d reached", s.hopLimit()))
+	}
+
+	var err error
+	for _, referral := range referrals {
+		var u *LDAPURL
+		if u, err = parseReferral(referral); err != nil {
+			continue
+		}
+
+		next := *searchRequest
+		if u.DN != "" {
+			next.BaseDN = u.DN
+		}
+		if continuation && searchRequest.Scope == ScopeSingleLevel {
+			next.Scope = ScopeBaseObject
+		}
+		if u.Filter != "" {
+			next.Filter = u.Filter
+		}
+
+		var conn *Conn
+		var nextServer string
+		if conn, nextServer, err = s.conn(ctx, l, server, u); err != nil {
+			continue
+		}
+		if err = s.visit(nextServer, next.BaseDN, next.Scope); err != nil {
+			return err
+		}
+		return s.search(ctx, conn, nextServer, &next, result, hops+1)
+	}
+	return err
+}
+
+// Add performs the given add request on l and follows the referrals it
+// returns.
+func (c *ReferralChaser) Add(ctx context.Context, l *Conn, addRequest *AddRequest) error {
+	return c.chase(ctx, l, addRequest.DN, func(conn *Conn, dn string) error {
+		req := *addRequest
+		req.DN = dn
+		return conn.AddContext(ctx, &req)
+	})
+}
+
+// Del performs the given delete request on l and follows the referrals it
+// returns.
+func (c *ReferralChaser) Del(ctx context.Context, l *Conn, delRequest *DelRequest) error {
+	return c.chase(ctx, l, delRequest.DN, func(conn *Conn, dn string) error {
+		req := *delRequest
+		req.DN = dn
+		return conn.DelContext(ctx, &req)
+	})
+}
+
+// Modify performs the given modify request on l and follows the referrals
+// it returns.
+func (c *ReferralChaser) Modify(ctx context.Context, l *Conn, modifyRequest *ModifyRequest) error {
+	return c.chase(ctx, l, modifyRequest.dn, func(conn *Conn, dn string) error {
+		req := *modifyRequest
+		req.dn = dn
+		return conn.ModifyContext(ctx, &req)
+	})
+}
+
+// ModifyDN performs the given modify DN request on l and follows the
+// referrals it returns.
+func (c *ReferralChaser) ModifyDN(ctx context.Context, l *Conn, modifyDNRequest *ModifyDNRequest) error {
+	return c.chase(ctx, l, modifyDNRequest.DN, func(conn *Conn, dn string) error {
+		req := *modifyDNRequest
+		req.DN = dn
+		return conn.ModifyDNContext(ctx, &req)
+	})
+}
+
+// chase runs op for dn on l, and again on the referred server for as long
+// as it fails with a referral.
+func (c *ReferralChaser) chase(ctx context.Context, l *Conn, dn string, op func(conn *Conn, dn string) error) error {
+	s := c.newSession(l)
+	defer s.close()
+
+	conn, server := l, ""
+	s.visit(server, dn, ScopeBaseObject)
+	for hops := 0; ; hops++ {
+		err := op(conn, dn)
+		referrals := referralsOf(err)
+		if len(referrals) == 0 {
+			return err
+		}
+		if hops >= s.hopLimit() {
+			return NewError(ErrorReferralLimit, fmt.Errorf("ldap: referral hop limit of %d reached", s.hopLimit()))
+		}
+
+		for _, referral := range referrals {
+			var u *LDAPURL
+			if u, err = parseReferral(referral); err != nil {
+				continue
+			}
+			nextDN := dn
+			if u.DN != "" {
+				nextDN = u.DN
+			}
+
+			var next *Conn
+			var nextServer string
+			if next, nextServer, err = s.conn(ctx, conn, server, u); err != nil {
+				continue
+			}
+			if err = s.visit(nextServer, nextDN, ScopeBaseObject); err != nil {
+				return err
+			}
+			conn, server, dn = next, nextServer, nextDN
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// conn returns the connection to the server of u. A URL without host
+// refers to the server of the current connection l.
+func (s *referralSession) conn(ctx context.Context, l *Conn, server string, u *LDAPURL) (*Conn, string, error) {
+	if u.Host == "" {
+		return l, server, nil
+	}
+	key := serverURL(u)
+	if s.isOrigin(key) {
+		return s.origin, "", nil
+	}
+	if conn, ok := s.conns[key]; ok {
+		return conn, key, nil
+	}
+
+	var conn *Conn
+	var err error
+	if s.chaser.Dial != nil {
+		conn, err = s.chaser.Dial(ctx, u)
+	} else if s.chaser.TLSConfig != nil {
+		conn, err = DialURL(key, DialWithTLSConfig(s.chaser.TLSConfig))
+	} else {
+		conn, err = DialURL(key)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if s.chaser.Bind != nil {
+		if err := s.chaser.Bind(ctx, conn, u); err != nil {
+			conn.Close()
+			return nil, "", err
+		}
+	}
+	s.conns[key] = conn
+	return conn, key, nil
+}
+
+// visit records an operation on dn at server, failing if it was done
+// before.
+func (s *referralSession) visit(server, dn string, scope int) error {
+	key := server + "/" + strings.ToLower(dn) + "?" + strconv.Itoa(scope)
+	if s.visited[key] {
+		return NewError(LDAPResultLoopDetect, fmt.Errorf("ldap: referral loop at %s/%s", server, dn))
+	}
+	s.visited[key] = true
+	return nil
+}
+
+// parseReferral parses a referral URL, rejecting critical extensions as
+// none are supported.
+func parseReferral(referral string) (*LDAPURL, error) {
+	u, err := ParseLDAPURL(referral)
+	if err != nil {
+		return nil, NewError(ErrorNetwork, err)
+	}
+	for _, ext := range u.Extensions {
+		if ext.Critical {
+			return nil, NewError(LDAPResultUnavailableCriticalExtension, fmt.Errorf("ldap: unsupported critical extension %q in referral", ext.Type))
+		}
+	}
+	return u, nil
+}
+
+// referralsOf returns the referral URLs of an LDAPResultReferral error.
+func referralsOf(err error) []string {
+	var ldapErr *Error
+	if errors.As(err, &ldapErr) && ldapErr.ResultCode == LDAPResultReferral {
+		return ldapErr.Referrals
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package ldap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// newSearchReference encodes a search result reference.
+func newSearchReference(urls ...string) *ber.Packet {
+	reference := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationSearchResultReference, nil, "Search Result Reference")
+	for _, url := range urls {
+		reference.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, url, "URI"))
+	}
+	return reference
+}
+
+// newReferralResult encodes an LDAPResult with a referral.
+func newReferralResult(tag ber.Tag, urls ...string) *ber.Packet {
+	result := newResult(tag, LDAPResultReferral, "")
+	referral := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, nil, "Referral")
+	for _, url := range urls {
+		referral.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, url, "URI"))
+	}
+	result.AppendChild(referral)
+	return result
+}
+
+// searchBase returns the base DN of a search request.
+func searchBase(request *ber.Packet) string {
+	return request.Children[1].Children[0].Value.(string)
+}
+
+func TestReferralChaserSearch(t *testing.T) {
+	var other *testServer
+	other = newTestServer(t, func(conn int, request *ber.Packet, server net.Conn) bool {
+		messageID := request.Children[0].Value.(int64)
+		switch searchBase(request) {
+		case "ou=people,dc=example,dc=com":
+			writeResponse(nil, server, messageID, newSearchEntry("cn=b,ou=people,dc=example,dc=com", "cn", "b"))
+			writeResponse(nil, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+		case "ou=loop,dc=example,dc=com":
+			writeResponse(nil, server, messageID, newReferralResult(ApplicationSearchResultDone, other.url()+"/ou=loop,dc=example,dc=com"))
+		}
+		return true
+	})
+	defer other.listener.Close()
+
+	l, server := newPipeConn()
+	defer l.Close()
+	requests := readRequests(server)
+	go func() {
+		for request := range requests {
+			messageID := request.Children[0].Value.(int64)
+			writeResponse(t, server, messageID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"))
+			writeResponse(t, server, messageID, newSearchReference("ldap://unreachable.invalid/ou=people,dc=example,dc=com", other.url()+"/ou=people,dc=example,dc=com"))
+			writeResponse(t, server, messageID, newSearchReference("ldap://unreachable.invalid/ou=other,dc=example,dc=com"))
+			writeResponse(t, server, messageID, newSearchReference(other.url()+"/ou=loop,dc=example,dc=com"))
+			writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+		}
+	}()
+
+	bound := 0
+	chaser := &ReferralChaser{
+		Bind: func(ctx context.Context, conn *Conn, u *LDAPURL) error {
+			bound++
+			return conn.BindContext(ctx, "cn=admin,dc=example,dc=com", "secret")
+		},
+		SkipUnreachable: true,
+	}
+	result, err := chaser.Search(context.Background(), l, NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Entries) != 2 || result.Entries[0].DN != "cn=a,dc=example,dc=com" || result.Entries[1].DN != "cn=b,ou=people,dc=example,dc=com" {
+		t.Fatalf("unexpected entries %v", result.Entries)
+	}
+	if expected := []string{"", other.url()}; !reflect.DeepEqual(result.Servers, expected) {
+		t.Errorf("expected servers %v, got %v", expected, result.Servers)
+	}
+	expected := []string{"ldap://unreachable.invalid/ou=other,dc=example,dc=com", other.url() + "/ou=loop,dc=example,dc=com"}
+	if !reflect.DeepEqual(result.Referrals, expected) {
+		t.Errorf("expected unfollowed referrals %v, got %v", expected, result.Referrals)
+	}
+	if conns, binds := other.stats(); conns != 1 || binds != 1 || bound != 1 {
+		t.Errorf("expected a single bound connection to the referred server, got %d connections and %d binds", conns, binds)
+	}
+}
+
+func TestReferralChaserLoop(t *testing.T) {
+	var s *testServer
+	s = newTestServer(t, func(conn int, request *ber.Packet, server net.Conn) bool {
+		writeResponse(nil, server, request.Children[0].Value.(int64), newReferralResult(ApplicationSearchResultDone, s.url()+"/dc=example,dc=com"))
+		return true
+	})
+	defer s.listener.Close()
+
+	l, err := DialURL(s.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	_, err = (&ReferralChaser{}).Search(context.Background(), l, NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+	if !IsErrorWithCode(err, LDAPResultLoopDetect) {
+		t.Errorf("expected a loop to be detected, got %v", err)
+	}
+	// The referral back to the original server is not chased
+	if conns, _ := s.stats(); conns != 1 {
+		t.Errorf("expected only the original connection, got %d connections", conns)
+	}
+}
+
+func TestReferralChaserOrigin(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+	go func() {
+		for request := range requests {
+			writeResponse(t, server, request.Children[0].Value.(int64), newReferralResult(ApplicationDelResponse, "ldap://LDAP1.example.com/cn=a,dc=example,dc=com"))
+		}
+	}()
+
+	chaser := &ReferralChaser{
+		Origin: "ldap://ldap1.example.com:389",
+		Dial: func(ctx context.Context, u *LDAPURL) (*Conn, error) {
+			t.Errorf("unexpected connection to %s", u)
+			return nil, NewError(ErrorNetwork, nil)
+		},
+	}
+	err := chaser.Del(context.Background(), l, NewDelRequest("cn=a,dc=example,dc=com", nil))
+	if !IsErrorWithCode(err, LDAPResultLoopDetect) {
+		t.Errorf("expected a loop to be detected, got %v", err)
+	}
+}
+
+func TestReferralChaserTLSConfig(t *testing.T) {
+	cert, err := newTestCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			server, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer server.Close()
+				for request := range readRequests(server) {
+					answerSearch(request, server)
+				}
+			}()
+		}
+	}()
+	referral := "ldaps://" + listener.Addr().String() + "/dc=example,dc=com"
+
+	for _, tlsConfig := range []*tls.Config{nil, {InsecureSkipVerify: true}} {
+		l, server := newPipeConn()
+		go func() {
+			request, ok := <-readRequests(server)
+			if ok {
+				writeResponse(t, server, request.Children[0].Value.(int64), newReferralResult(ApplicationSearchResultDone, referral))
+			}
+		}()
+
+		chaser := &ReferralChaser{TLSConfig: tlsConfig}
+		result, err := chaser.Search(context.Background(), l, NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(objectClass=*)", nil, nil))
+		switch {
+		case tlsConfig == nil && err == nil:
+			t.Error("expected the self-signed certificate to be rejected")
+		case tlsConfig != nil && err != nil:
+			t.Errorf("expected the TLS config to be used, got %v", err)
+		case tlsConfig != nil && len(result.Entries) != 1:
+			t.Errorf("expected an entry from the referred server, got %v", result.Entries)
+		}
+		l.Close()
+		server.Close()
+	}
+}
+
+// newTestCertificate returns a self-signed certificate for 127.0.0.1.
+func newTestCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func TestReferralChaserUpdate(t *testing.T) {
+	var mu sync.Mutex
+	var targets []string
+	other := newTestServer(t, func(conn int, request *ber.Packet, server net.Conn) bool {
+		op := request.Children[1]
+		messageID := request.Children[0].Value.(int64)
+		mu.Lock()
+		targets = append(targets, op.Children[0].Value.(string))
+		mu.Unlock()
+		switch op.Tag {
+		case ApplicationAddRequest:
+			writeResponse(nil, server, messageID, newResult(ApplicationAddResponse, LDAPResultSuccess, ""))
+		case ApplicationModifyRequest:
+			// refers back to itself for another DN, which is fine, and
+			// then once more, which is beyond the hop limit
+			writeResponse(nil, server, messageID, newReferralResult(ApplicationModifyResponse, "ldap:///cn=again"+op.Children[0].Value.(string)))
+		}
+		return true
+	})
+	defer other.listener.Close()
+
+	l, server := newPipeConn()
+	defer l.Close()
+	go func() {
+		for request := range readRequests(server) {
+			tag := ApplicationAddResponse
+			if request.Children[1].Tag == ApplicationModifyRequest {
+				tag = ApplicationModifyResponse
+			}
+			writeResponse(t, server, request.Children[0].Value.(int64), newReferralResult(ber.Tag(tag), "ldap://unreachable.invalid", other.url()+"/cn=new,dc=example,dc=com"))
+		}
+	}()
+
+	chaser := &ReferralChaser{HopLimit: 2}
+	if err := chaser.Add(context.Background(), l, NewAddRequest("cn=old,dc=example,dc=com", nil)); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if !reflect.DeepEqual(targets, []string{"cn=new,dc=example,dc=com"}) {
+		t.Errorf("unexpected add targets %v", targets)
+	}
+	mu.Unlock()
+
+	err := chaser.Modify(context.Background(), l, NewModifyRequest("cn=old,dc=example,dc=com"))
+	if !IsErrorWithCode(err, ErrorReferralLimit) {
+		t.Errorf("expected the hop limit to be reached, got %v", err)
+	}
+}
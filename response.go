@@ -0,0 +1,265 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// IntermediateResponse is an intermediate response message (RFC 4511,
+// section 4.13) received while a search is in progress, such as the Sync
+// Info message of a content synchronization.
+type IntermediateResponse struct {
+	Name  string
+	Value []byte
+}
+
+// SearchResponse is a handle on a search started with SearchAsync. Results
+// are read one at a time with Next as they arrive from the server, rather
+// than being collected in a SearchResult.
+//
+// Results that arrive faster than Next is called are held for the handle
+// until they are read, see DialWithQueueSize. They never hold up other
+// operations on the same Conn, so those may be run from the loop reading
+// the handle. Close the handle to drop the results that were not read.
+type SearchResponse struct {
+	conn      *Conn
+	ctx       context.Context
+	messageID int64
+	channel   chan *ber.Packet
+
+	entry        *Entry
+	referrals    []string
+	intermediate *IntermediateResponse
+	controls     []Control
+
+	err      error
+	done     bool
+	finished bool
+	once     sync.Once
+}
+
+// SearchAsync sends searchRequest and returns a handle to read its results
+// with. The search is abandoned when ctx is done or when the handle is
+// closed before all results have been read.
+//
+//	response := l.SearchAsync(ctx, searchRequest)
+//	defer response.Close()
+//	for response.Next() {
+//		if entry := response.Entry(); entry != nil {
+//			...
+//		}
+//	}
+//	if err := response.Err(); err != nil {
+//		...
+//	}
+func (l *Conn) SearchAsync(ctx context.Context, searchRequest *SearchRequest) *SearchResponse {
+	r := &SearchResponse{
+		conn:      l,
+		ctx:       ctx,
+		messageID: l.nextMessageID(),
+	}
+
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, r.messageID, "MessageID"))
+	// encode search request
+	encodedSearchRequest, err := searchRequest.encode()
+	if err != nil {
+		r.err, r.done = err, true
+		return r
+	}
+	packet.AppendChild(encodedSearchRequest)
+	// encode search controls
+	if searchRequest.Controls != nil {
+		packet.AppendChild(encodeControls(searchRequest.Controls))
+	}
+
+	l.Debug.PrintPacket(packet)
+
+	channel, err := l.sendMessage(packet)
+	if err != nil {
+		r.err, r.done = err, true
+		return r
+	}
+	if channel == nil {
+		r.err, r.done = NewError(ErrorNetwork, errors.New("ldap: could not send message")), true
+		return r
+	}
+	r.channel = channel
+	return r
+}
+
+// MessageID returns the message ID of the search, as used by Abandon and
+// Cancel.
+func (r *SearchResponse) MessageID() int64 {
+	return r.messageID
+}
+
+// Next waits for the next search result entry, search result reference or
+// intermediate response. It returns false once the search is done, either
+// because the server sent the final result or because of an error, which
+// is then returned by Err.
+func (r *SearchResponse) Next() bool {
+	if r.done {
+		return false
+	}
+	r.entry, r.referrals, r.intermediate, r.controls = nil, nil, nil, nil
+
+	l := r.conn
+	for {
+		l.Debug.Printf("%d: waiting for response", r.messageID)
+		packet, err := l.readPacket(r.ctx, r.messageID, r.channel)
+		if err != nil {
+			r.finish(err)
+			return false
+		}
+		l.Debug.Printf("%d: got response %p", r.messageID, packet)
+		if packet == nil {
+			r.finish(NewError(ErrorNetwork, errors.New("ldap: could not retrieve message")))
+			return false
+		}
+
+		if l.Debug {
+			if err := addLDAPDescriptions(packet); err != nil {
+				r.finish(err)
+				return false
+			}
+			ber.PrintPacket(packet)
+		}
+
+		switch packet.Children[1].Tag {
+		case ApplicationSearchResultEntry:
+			r.entry = decodeEntry(packet.Children[1])
+			r.controls = decodePacketControls(packet)
+			return true
+		case ApplicationSearchResultDone:
+			r.finished = true
+			resultCode, resultDescription := getLDAPResultCode(packet)
+			if resultCode != 0 {
+				r.finish(newResultError(packet, resultCode, resultDescription))
+				return false
+			}
+			r.controls = decodePacketControls(packet)
+			r.finish(nil)
+			return false
+		case ApplicationSearchResultReference:
+			// The URIs are alternatives for the same continuation
+			var referrals []string
+			for _, child := range packet.Children[1].Children {
+				referrals = append(referrals, string(child.Data.Bytes()))
+			}
+			if len(referrals) == 0 {
+				l.Debug.Printf("%d: search result reference without URIs", r.messageID)
+				continue
+			}
+			r.referrals = referrals
+			r.controls = decodePacketControls(packet)
+			return true
+		case ApplicationIntermediateResponse:
+			r.intermediate = decodeIntermediateResponse(packet.Children[1])
+			r.controls = decodePacketControls(packet)
+			return true
+		default:
+			l.Debug.Printf("%d: unknown tag: %v", r.messageID, packet.Children[1].Tag)
+		}
+	}
+}
+
+// Entry returns the search result entry read by the last call to Next, or
+// nil if it read something else.
+func (r *SearchResponse) Entry() *Entry {
+	return r.entry
+}
+
+// Referral returns the first URL of the search result reference read by
+// the last call to Next, or "" if it read something else.
+func (r *SearchResponse) Referral() string {
+	if len(r.referrals) == 0 {
+		return ""
+	}
+	return r.referrals[0]
+}
+
+// Referrals returns all URLs of the search result reference read by the
+// last call to Next, which are alternatives for the same continuation, or
+// nil if it read something else.
+func (r *SearchResponse) Referrals() []string {
+	return r.referrals
+}
+
+// Intermediate returns the intermediate response read by the last call to
+// Next, or nil if it read something else.
+func (r *SearchResponse) Intermediate() *IntermediateResponse {
+	return r.intermediate
+}
+
+// Controls returns the controls sent with the message read by the last call
+// to Next. Once Next has returned false, these are the controls of the
+// final search result, e.g. the paging control.
+func (r *SearchResponse) Controls() []Control {
+	return r.controls
+}
+
+// Err returns the error that ended the search, if any.
+func (r *SearchResponse) Err() error {
+	return r.err
+}
+
+// Close releases the handle. If the search is still in progress it is
+// abandoned on the server.
+func (r *SearchResponse) Close() {
+	if r.done {
+		return
+	}
+	if err := r.conn.Abandon(r.messageID); err != nil {
+		r.conn.Debug.Printf("%d: could not abandon: %s", r.messageID, err.Error())
+	}
+	r.finish(nil)
+}
+
+func (r *SearchResponse) finish(err error) {
+	r.once.Do(func() {
+		r.err, r.done = err, true
+		r.conn.finishMessage(r.messageID)
+	})
+}
+
+func decodeEntry(packet *ber.Packet) *Entry {
+	entry := new(Entry)
+	entry.DN = packet.Children[0].Value.(string)
+	for _, child := range packet.Children[1].Children {
+		attr := new(EntryAttribute)
+		attr.Name = child.Children[0].Value.(string)
+		for _, value := range child.Children[1].Children {
+			attr.Values = append(attr.Values, value.Value.(string))
+			attr.ByteValues = append(attr.ByteValues, value.ByteValue)
+		}
+		entry.Attributes = append(entry.Attributes, attr)
+	}
+	return entry
+}
+
+func decodeIntermediateResponse(packet *ber.Packet) *IntermediateResponse {
+	response := new(IntermediateResponse)
+	for _, child := range packet.Children {
+		switch child.Tag {
+		case 0:
+			response.Name = string(child.Data.Bytes())
+		case 1:
+			response.Value = child.Data.Bytes()
+		}
+	}
+	return response
+}
+
+func decodePacketControls(packet *ber.Packet) []Control {
+	controls := make([]Control, 0)
+	if len(packet.Children) == 3 {
+		for _, child := range packet.Children[2].Children {
+			controls = append(controls, DecodeControl(child))
+		}
+	}
+	return controls
+}
@@ -0,0 +1,239 @@
+// File contains SASL Bind functionality
+//
+// https://tools.ietf.org/html/rfc4513#section-5.2
+//
+// BindRequest ::= [APPLICATION 0] SEQUENCE {
+//      version                 INTEGER (1 ..  127),
+//      name                    LDAPDN,
+//      authentication          AuthenticationChoice }
+//
+// AuthenticationChoice ::= CHOICE {
+//      simple                  [0] OCTET STRING,
+//                              -- 1 and 2 reserved
+//      sasl                    [3] SaslCredentials,
+//      ...  }
+//
+// SaslCredentials ::= SEQUENCE {
+//      mechanism               LDAPString,
+//      credentials             OCTET STRING OPTIONAL }
+//
+// BindResponse ::= [APPLICATION 1] SEQUENCE {
+//      COMPONENTS OF LDAPResult,
+//      serverSaslCreds    [7] OCTET STRING OPTIONAL }
+//
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// SaslMechanism is implemented by the client side of a SASL mechanism.
+// It follows the same protocol as net/smtp.Auth, so additional mechanisms
+// can be plugged in by implementing it.
+type SaslMechanism interface {
+	// Start begins the authentication. It returns the name of the mechanism
+	// and the initial response to send with the first bind request, or nil
+	// if the mechanism has no initial response.
+	Start() (mechanism string, toServer []byte, err error)
+
+	// Next continues the authentication with the credentials the server
+	// sent. more is true while the server expects another response, which
+	// Next then returns. Once the bind succeeded, Next is called a last
+	// time with more set to false and the data the server sent with the
+	// success, if any, so the mechanism can verify the server; returning an
+	// error then fails the bind.
+	Next(fromServer []byte, more bool) (toServer []byte, err error)
+}
+
+type SaslBindRequest struct {
+	Mechanism SaslMechanism
+	Controls  []Control
+}
+
+type SaslBindResult struct {
+	Controls []Control
+}
+
+// PasswordPolicy returns the password policy status reported by the
+// server with the final bind response, or nil if it did not send any.
+func (r *SaslBindResult) PasswordPolicy() *PasswordPolicyStatus {
+	return passwordPolicyStatus(r.Controls)
+}
+
+func NewSaslBindRequest(mechanism SaslMechanism, controls []Control) *SaslBindRequest {
+	return &SaslBindRequest{
+		Mechanism: mechanism,
+		Controls:  controls,
+	}
+}
+
+func encodeSaslBindRequest(mechanism string, credentials []byte) *ber.Packet {
+	request := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationBindRequest, nil, "Bind Request")
+	request.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, 3, "Version"))
+	request.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "User Name"))
+
+	sasl := ber.Encode(ber.ClassContext, ber.TypeConstructed, 3, nil, "SASL Credentials")
+	sasl.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, mechanism, "Mechanism"))
+	if credentials != nil {
+		sasl.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(credentials), "Credentials"))
+	}
+	request.AppendChild(sasl)
+
+	return request
+}
+
+// SaslBind authenticates with the given SASL mechanism, sending bind
+// requests until the server reports success or failure. The controls are
+// sent with every bind request, and the controls of the final response are
+// returned.
+func (l *Conn) SaslBind(saslBindRequest *SaslBindRequest) (*SaslBindResult, error) {
+	return l.SaslBindContext(context.Background(), saslBindRequest)
+}
+
+// SaslBindContext is like SaslBind, but gives up waiting for the response
+// and abandons the request when ctx is done.
+func (l *Conn) SaslBindContext(ctx context.Context, saslBindRequest *SaslBindRequest) (*SaslBindResult, error) {
+	mechanism, credentials, err := saslBindRequest.Mechanism.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		packet, err := l.bindPacket(ctx, encodeSaslBindRequest(mechanism, credentials), saslBindRequest.Controls)
+		if err != nil {
+			return nil, err
+		}
+
+		result := &SaslBindResult{
+			Controls: decodePacketControls(packet),
+		}
+
+		var serverCredentials []byte
+		for _, child := range packet.Children[1].Children {
+			if child.ClassType == ber.ClassContext && child.Tag == 7 {
+				serverCredentials = child.Data.Bytes()
+			}
+		}
+
+		resultCode, resultDescription := getLDAPResultCode(packet)
+		switch resultCode {
+		case LDAPResultSaslBindInProgress:
+			credentials, err = saslBindRequest.Mechanism.Next(serverCredentials, true)
+			if err != nil {
+				return result, err
+			}
+		case LDAPResultSuccess:
+			if _, err := saslBindRequest.Mechanism.Next(serverCredentials, false); err != nil {
+				return result, err
+			}
+			return result, nil
+		default:
+			return result, NewError(resultCode, errors.New(resultDescription))
+		}
+	}
+}
+
+// bindPacket sends a single bind request and returns the bind response.
+func (l *Conn) bindPacket(ctx context.Context, bindRequest *ber.Packet, controls []Control) (*ber.Packet, error) {
+	messageID := l.nextMessageID()
+
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	packet.AppendChild(bindRequest)
+	if len(controls) > 0 {
+		packet.AppendChild(encodeControls(controls))
+	}
+	atomic.AddUint64(&l.binds, 1)
+
+	l.Debug.PrintPacket(packet)
+
+	channel, err := l.sendMessage(packet)
+	if err != nil {
+		return nil, err
+	}
+	if channel == nil {
+		return nil, NewError(ErrorNetwork, errors.New("ldap: could not send message"))
+	}
+	defer l.finishMessage(messageID)
+
+	l.Debug.Printf("%d: waiting for response", messageID)
+	packet, err = l.readPacket(ctx, messageID, channel)
+	if err != nil {
+		return nil, err
+	}
+	l.Debug.Printf("%d: got response %p", messageID, packet)
+	if packet == nil {
+		return nil, NewError(ErrorNetwork, errors.New("ldap: could not retrieve response"))
+	}
+
+	if l.Debug {
+		if err := addLDAPDescriptions(packet); err != nil {
+			return nil, err
+		}
+		ber.PrintPacket(packet)
+	}
+
+	if packet.Children[1].Tag != ApplicationBindResponse {
+		return nil, NewError(ErrorUnexpectedResponse, fmt.Errorf("Unexpected Response: %d", packet.Children[1].Tag))
+	}
+	return packet, nil
+}
+
+type saslExternal struct {
+	authzID string
+}
+
+// NewSaslExternal returns the EXTERNAL mechanism (RFC 4422, appendix A),
+// which authenticates with credentials established outside of LDAP: the
+// client certificate of a TLS connection made with DialTLS or StartTLS, or
+// the peer credentials of an ldapi:// socket. authzID is the identity to
+// act as, or "" to use the identity derived from those credentials.
+func NewSaslExternal(authzID string) SaslMechanism {
+	return &saslExternal{authzID: authzID}
+}
+
+func (m *saslExternal) Start() (string, []byte, error) {
+	return "EXTERNAL", []byte(m.authzID), nil
+}
+
+func (m *saslExternal) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("ldap: unexpected server challenge for SASL EXTERNAL")
+	}
+	return nil, nil
+}
+
+type saslPlain struct {
+	authzID  string
+	username string
+	password string
+}
+
+// NewSaslPlain returns the PLAIN mechanism (RFC 4616), which sends the
+// username and password in the clear. It should only be used over TLS or
+// a local socket. authzID is the identity to act as, or "" to act as
+// username.
+func NewSaslPlain(authzID, username, password string) SaslMechanism {
+	return &saslPlain{
+		authzID:  authzID,
+		username: username,
+		password: password,
+	}
+}
+
+func (m *saslPlain) Start() (string, []byte, error) {
+	return "PLAIN", []byte(m.authzID + "\x00" + m.username + "\x00" + m.password), nil
+}
+
+func (m *saslPlain) Next(fromServer []byte, more bool) ([]byte, error) {
+	if more {
+		return nil, errors.New("ldap: unexpected server challenge for SASL PLAIN")
+	}
+	return nil, nil
+}
@@ -0,0 +1,216 @@
+// File contains the DIGEST-MD5 SASL mechanism
+//
+// https://tools.ietf.org/html/rfc2831
+//
+
+package ldap
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	enchex "encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type saslDigestMD5 struct {
+	authzID  string
+	username string
+	password string
+	host     string
+	service  string
+
+	step   int
+	cnonce func() (string, error)
+	a1     []byte
+	a2     string
+	rest   string
+}
+
+// NewSaslDigestMD5 returns the DIGEST-MD5 mechanism (RFC 2831). host is the
+// name of the LDAP server as it is known to the server, used in the digest
+// URI. authzID is the identity to act as, or "" to act as username.
+//
+// Only the "auth" quality of protection is supported: no integrity or
+// confidentiality layer is negotiated, so the connection should still be
+// protected with TLS where that matters.
+func NewSaslDigestMD5(authzID, username, password, host string) SaslMechanism {
+	return &saslDigestMD5{
+		authzID:  authzID,
+		username: username,
+		password: password,
+		host:     host,
+		service:  "ldap",
+		cnonce:   randomNonce,
+	}
+}
+
+func (m *saslDigestMD5) Start() (string, []byte, error) {
+	m.step = 0
+	return "DIGEST-MD5", nil, nil
+}
+
+func (m *saslDigestMD5) Next(fromServer []byte, more bool) ([]byte, error) {
+	switch m.step {
+	case 0:
+		if !more {
+			return nil, errors.New("ldap: DIGEST-MD5 bind completed without a challenge")
+		}
+		m.step++
+		return m.response(fromServer)
+	case 1:
+		m.step++
+		if fromServer == nil {
+			return nil, errors.New("ldap: DIGEST-MD5 bind completed without the server's response-auth")
+		}
+		if err := m.verify(fromServer); err != nil {
+			return nil, err
+		}
+		if more {
+			return []byte{}, nil
+		}
+		return nil, nil
+	default:
+		if more {
+			return nil, errors.New("ldap: unexpected server challenge for SASL DIGEST-MD5")
+		}
+		return nil, nil
+	}
+}
+
+// response computes the digest-response to the server's digest-challenge.
+func (m *saslDigestMD5) response(challenge []byte) ([]byte, error) {
+	directives, err := parseDigestDirectives(string(challenge))
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := directives["nonce"]
+	if nonce == "" {
+		return nil, errors.New("ldap: DIGEST-MD5 challenge without nonce")
+	}
+	if qop, ok := directives["qop"]; ok && !containsToken(qop, "auth") {
+		return nil, fmt.Errorf("ldap: DIGEST-MD5 qop %q not supported", qop)
+	}
+	realm := directives["realm"]
+	cnonce, err := m.cnonce()
+	if err != nil {
+		return nil, err
+	}
+	digestURI := m.service + "/" + m.host
+
+	userHash := md5.Sum([]byte(m.username + ":" + realm + ":" + m.password))
+	m.a1 = append(userHash[:], ":"+nonce+":"+cnonce...)
+	if m.authzID != "" {
+		m.a1 = append(m.a1, ":"+m.authzID...)
+	}
+	m.a2 = ":" + digestURI
+	m.rest = nonce + ":00000001:" + cnonce + ":auth:"
+
+	var response []string
+	if charset, ok := directives["charset"]; ok {
+		response = append(response, "charset="+charset)
+	}
+	response = append(response,
+		"username="+quoteDigestValue(m.username),
+		"realm="+quoteDigestValue(realm),
+		"nonce="+quoteDigestValue(nonce),
+		"nc=00000001",
+		"cnonce="+quoteDigestValue(cnonce),
+		"digest-uri="+quoteDigestValue(digestURI),
+		"response="+m.digest("AUTHENTICATE"),
+		"qop=auth",
+	)
+	if m.authzID != "" {
+		response = append(response, "authzid="+quoteDigestValue(m.authzID))
+	}
+	return []byte(strings.Join(response, ",")), nil
+}
+
+// verify checks the response-auth the server sends after a successful
+// authentication, which proves that it knows the password too.
+func (m *saslDigestMD5) verify(fromServer []byte) error {
+	directives, err := parseDigestDirectives(string(fromServer))
+	if err != nil {
+		return err
+	}
+	if directives["rspauth"] != m.digest("") {
+		return errors.New("ldap: DIGEST-MD5 server authentication failed")
+	}
+	return nil
+}
+
+func (m *saslDigestMD5) digest(method string) string {
+	a1 := md5.Sum(m.a1)
+	a2 := md5.Sum([]byte(method + m.a2))
+	kd := md5.Sum([]byte(enchex.EncodeToString(a1[:]) + ":" + m.rest + enchex.EncodeToString(a2[:])))
+	return enchex.EncodeToString(kd[:])
+}
+
+// parseDigestDirectives parses a comma separated list of name=value
+// directives, where values may be quoted strings.
+func parseDigestDirectives(s string) (map[string]string, error) {
+	directives := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return directives, nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("ldap: malformed DIGEST-MD5 directive %q", s)
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value []byte
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value = append(value, s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("ldap: unterminated DIGEST-MD5 directive %q", name)
+			}
+			s = s[i+1:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = []byte(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+
+		// Only the first realm is used, the others are alternatives
+		if _, ok := directives[name]; !ok {
+			directives[name] = string(value)
+		}
+	}
+}
+
+func quoteDigestValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func containsToken(list, token string) bool {
+	for _, t := range strings.Split(list, ",") {
+		if strings.TrimSpace(t) == token {
+			return true
+		}
+	}
+	return false
+}
+
+// randomNonce returns a random value suitable as a client nonce.
+func randomNonce() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return enchex.EncodeToString(b), nil
+}
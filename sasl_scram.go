@@ -0,0 +1,195 @@
+// File contains the SCRAM SASL mechanisms
+//
+// https://tools.ietf.org/html/rfc5802
+// https://tools.ietf.org/html/rfc7677
+//
+
+package ldap
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+type saslScram struct {
+	name     string
+	hash     func() hash.Hash
+	authzID  string
+	username string
+	password string
+
+	step            int
+	cnonce          func() (string, error)
+	clientFirstBare string
+	serverSignature []byte
+}
+
+// NewSaslScramSHA1 returns the SCRAM-SHA-1 mechanism (RFC 5802). authzID is
+// the identity to act as, or "" to act as username. Channel binding is not
+// supported, and the password is used as given, without SASLprep.
+func NewSaslScramSHA1(authzID, username, password string) SaslMechanism {
+	return newSaslScram("SCRAM-SHA-1", sha1.New, authzID, username, password)
+}
+
+// NewSaslScramSHA256 returns the SCRAM-SHA-256 mechanism (RFC 7677). See
+// NewSaslScramSHA1.
+func NewSaslScramSHA256(authzID, username, password string) SaslMechanism {
+	return newSaslScram("SCRAM-SHA-256", sha256.New, authzID, username, password)
+}
+
+func newSaslScram(name string, hash func() hash.Hash, authzID, username, password string) *saslScram {
+	return &saslScram{
+		name:     name,
+		hash:     hash,
+		authzID:  authzID,
+		username: username,
+		password: password,
+		cnonce:   randomNonce,
+	}
+}
+
+func (m *saslScram) gs2Header() string {
+	if m.authzID == "" {
+		return "n,,"
+	}
+	return "n,a=" + scramName(m.authzID) + ","
+}
+
+func (m *saslScram) Start() (string, []byte, error) {
+	cnonce, err := m.cnonce()
+	if err != nil {
+		return "", nil, err
+	}
+	m.step = 0
+	m.clientFirstBare = "n=" + scramName(m.username) + ",r=" + cnonce
+	return m.name, []byte(m.gs2Header() + m.clientFirstBare), nil
+}
+
+func (m *saslScram) Next(fromServer []byte, more bool) ([]byte, error) {
+	switch m.step {
+	case 0:
+		if !more {
+			return nil, fmt.Errorf("ldap: %s bind completed without a challenge", m.name)
+		}
+		m.step++
+		return m.clientFinal(string(fromServer))
+	case 1:
+		m.step++
+		if fromServer == nil {
+			return nil, fmt.Errorf("ldap: %s bind completed without the server signature", m.name)
+		}
+		if err := m.verify(string(fromServer)); err != nil {
+			return nil, err
+		}
+		if more {
+			return []byte{}, nil
+		}
+		return nil, nil
+	default:
+		if more {
+			return nil, fmt.Errorf("ldap: unexpected server challenge for SASL %s", m.name)
+		}
+		return nil, nil
+	}
+}
+
+// clientFinal computes the client-final-message from the
+// server-first-message.
+func (m *saslScram) clientFinal(serverFirst string) ([]byte, error) {
+	attributes := parseScramAttributes(serverFirst)
+	if e, ok := attributes["e"]; ok {
+		return nil, fmt.Errorf("ldap: %s server error: %s", m.name, e)
+	}
+
+	nonce := attributes["r"]
+	clientNonce := m.clientFirstBare[strings.Index(m.clientFirstBare, ",r=")+3:]
+	if !strings.HasPrefix(nonce, clientNonce) || len(nonce) == len(clientNonce) {
+		return nil, fmt.Errorf("ldap: %s server nonce does not extend the client nonce", m.name)
+	}
+	salt, err := base64.StdEncoding.DecodeString(attributes["s"])
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("ldap: %s invalid salt %q", m.name, attributes["s"])
+	}
+	iterations, err := strconv.Atoi(attributes["i"])
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("ldap: %s invalid iteration count %q", m.name, attributes["i"])
+	}
+
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(m.gs2Header())) + ",r=" + nonce
+	authMessage := []byte(m.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+
+	saltedPassword := m.hi([]byte(m.password), salt, iterations)
+	clientKey := m.hmac(saltedPassword, []byte("Client Key"))
+	storedKey := m.h(clientKey)
+	clientSignature := m.hmac(storedKey, authMessage)
+	clientProof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		clientProof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	serverKey := m.hmac(saltedPassword, []byte("Server Key"))
+	m.serverSignature = m.hmac(serverKey, authMessage)
+
+	return []byte(clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(clientProof)), nil
+}
+
+// verify checks the server signature of the server-final-message, which
+// proves that the server knows the password too.
+func (m *saslScram) verify(serverFinal string) error {
+	attributes := parseScramAttributes(serverFinal)
+	if e, ok := attributes["e"]; ok {
+		return fmt.Errorf("ldap: %s server error: %s", m.name, e)
+	}
+	serverSignature, err := base64.StdEncoding.DecodeString(attributes["v"])
+	if err != nil || !hmac.Equal(serverSignature, m.serverSignature) {
+		return errors.New("ldap: " + m.name + " server authentication failed")
+	}
+	return nil
+}
+
+func (m *saslScram) h(data []byte) []byte {
+	h := m.hash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func (m *saslScram) hmac(key, data []byte) []byte {
+	mac := hmac.New(m.hash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// hi is PBKDF2 with HMAC as the pseudorandom function and a single block
+// of output, as defined in RFC 5802, section 2.2.
+func (m *saslScram) hi(password, salt []byte, iterations int) []byte {
+	u := m.hmac(password, append(append([]byte{}, salt...), 0, 0, 0, 1))
+	result := append([]byte{}, u...)
+	for i := 1; i < iterations; i++ {
+		u = m.hmac(password, u)
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+// scramName escapes a username or authzid as a saslname.
+func scramName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
+
+func parseScramAttributes(message string) map[string]string {
+	attributes := map[string]string{}
+	for _, attribute := range strings.Split(message, ",") {
+		if len(attribute) >= 2 && attribute[1] == '=' {
+			attributes[attribute[:1]] = attribute[2:]
+		}
+	}
+	return attributes
+}
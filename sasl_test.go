@@ -0,0 +1,241 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// saslCredentials returns the mechanism and credentials of a SASL bind
+// request, as read by the server.
+func saslCredentials(t *testing.T, request *ber.Packet) (string, []byte) {
+	if request.Children[1].Tag != ApplicationBindRequest {
+		t.Fatalf("expected a bind request, got tag %d", request.Children[1].Tag)
+	}
+	sasl := request.Children[1].Children[2]
+	if sasl.ClassType != ber.ClassContext || sasl.Tag != 3 {
+		t.Fatalf("expected SASL credentials, got tag %d", sasl.Tag)
+	}
+	mechanism := sasl.Children[0].Value.(string)
+	if len(sasl.Children) < 2 {
+		return mechanism, nil
+	}
+	return mechanism, sasl.Children[1].Data.Bytes()
+}
+
+// newBindResponse encodes a bind response, with server SASL credentials
+// unless they are nil.
+func newBindResponse(resultCode int, serverCredentials []byte) *ber.Packet {
+	response := newResult(ApplicationBindResponse, resultCode, "")
+	if serverCredentials != nil {
+		response.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 7, string(serverCredentials), "Server SASL Credentials"))
+	}
+	return response
+}
+
+func TestSaslBindSingleStep(t *testing.T) {
+	testcases := []struct {
+		mechanism   SaslMechanism
+		name        string
+		credentials string
+	}{
+		{NewSaslExternal(""), "EXTERNAL", ""},
+		{NewSaslExternal("dn:cn=admin,dc=example,dc=com"), "EXTERNAL", "dn:cn=admin,dc=example,dc=com"},
+		{NewSaslPlain("", "jdoe", "secret"), "PLAIN", "\x00jdoe\x00secret"},
+		{NewSaslPlain("admin", "jdoe", "secret"), "PLAIN", "admin\x00jdoe\x00secret"},
+	}
+
+	for _, testcase := range testcases {
+		testcase := testcase
+		l, server := newPipeConn()
+		requests := readRequests(server)
+
+		go func() {
+			request := <-requests
+			mechanism, credentials := saslCredentials(t, request)
+			if mechanism != testcase.name || string(credentials) != testcase.credentials {
+				t.Errorf("expected %s %q, got %s %q", testcase.name, testcase.credentials, mechanism, credentials)
+			}
+			writeResponse(t, server, request.Children[0].Value.(int64), newBindResponse(LDAPResultSuccess, nil))
+		}()
+
+		if _, err := l.SaslBind(NewSaslBindRequest(testcase.mechanism, nil)); err != nil {
+			t.Errorf("%s: %s", testcase.name, err)
+		}
+		l.Close()
+		server.Close()
+	}
+}
+
+// saslStep is one round trip with a fake SASL server: the credentials it
+// expects from the client, and the result code and server credentials it
+// answers with.
+type saslStep struct {
+	credentials       string
+	resultCode        int
+	serverCredentials []byte
+}
+
+// serveSasl plays the server side of a SASL exchange on server.
+func serveSasl(t *testing.T, server net.Conn, mechanism string, steps []saslStep) {
+	requests := readRequests(server)
+	for i, step := range steps {
+		request, ok := <-requests
+		if !ok {
+			t.Errorf("step %d: connection closed", i)
+			return
+		}
+		name, credentials := saslCredentials(t, request)
+		if name != mechanism {
+			t.Errorf("step %d: expected mechanism %s, got %s", i, mechanism, name)
+		}
+		if string(credentials) != step.credentials {
+			t.Errorf("step %d: expected credentials\n%q\ngot\n%q", i, step.credentials, credentials)
+		}
+		writeResponse(t, server, request.Children[0].Value.(int64), newBindResponse(step.resultCode, step.serverCredentials))
+	}
+}
+
+func fixedNonce(nonce string) func() (string, error) {
+	return func() (string, error) {
+		return nonce, nil
+	}
+}
+
+func TestSaslBindDigestMD5(t *testing.T) {
+	// Example from RFC 2831, section 4
+	m := NewSaslDigestMD5("", "chris", "secret", "elwood.innosoft.com").(*saslDigestMD5)
+	m.service = "imap"
+	m.cnonce = fixedNonce("OA6MHXh6VqTrRk")
+
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	go serveSasl(t, server, "DIGEST-MD5", []saslStep{
+		{"", LDAPResultSaslBindInProgress, []byte(`realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`)},
+		{`charset=utf-8,username="chris",realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",nc=00000001,cnonce="OA6MHXh6VqTrRk",digest-uri="imap/elwood.innosoft.com",response=d388dad90d4bbd760a152321f2143af7,qop=auth`,
+			LDAPResultSaslBindInProgress, []byte("rspauth=ea40f60335c427b5527b84dbabcdfffd")},
+		{"", LDAPResultSuccess, nil},
+	})
+
+	if _, err := l.SaslBind(NewSaslBindRequest(m, nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSaslBindScram(t *testing.T) {
+	testcases := []struct {
+		mechanism   SaslMechanism
+		name        string
+		cnonce      string
+		clientFirst string
+		serverFirst string
+		clientFinal string
+		serverFinal string
+	}{
+		// Example from RFC 5802, section 5
+		{
+			NewSaslScramSHA1("", "user", "pencil"), "SCRAM-SHA-1",
+			"fyko+d2lbbFgONRv9qkxdawL",
+			"n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL",
+			"r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+			"c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+			"v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+		},
+		// Example from RFC 7677, section 3
+		{
+			NewSaslScramSHA256("", "user", "pencil"), "SCRAM-SHA-256",
+			"rOprNGfwEbeRWgbNEkqO",
+			"n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+			"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+			"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+		},
+	}
+
+	for _, testcase := range testcases {
+		m := testcase.mechanism.(*saslScram)
+		m.cnonce = fixedNonce(testcase.cnonce)
+
+		l, server := newPipeConn()
+		go serveSasl(t, server, testcase.name, []saslStep{
+			{testcase.clientFirst, LDAPResultSaslBindInProgress, []byte(testcase.serverFirst)},
+			{testcase.clientFinal, LDAPResultSuccess, []byte(testcase.serverFinal)},
+		})
+		if _, err := l.SaslBind(NewSaslBindRequest(m, nil)); err != nil {
+			t.Errorf("%s: %s", testcase.name, err)
+		}
+		l.Close()
+		server.Close()
+	}
+}
+
+func TestSaslBindScramBadServerSignature(t *testing.T) {
+	m := NewSaslScramSHA256("", "user", "pencil").(*saslScram)
+	m.cnonce = fixedNonce("rOprNGfwEbeRWgbNEkqO")
+
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	go serveSasl(t, server, "SCRAM-SHA-256", []saslStep{
+		{"n,,n=user,r=rOprNGfwEbeRWgbNEkqO", LDAPResultSaslBindInProgress, []byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")},
+		{"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", LDAPResultSuccess, []byte("v=rmF9pqV8S7suAoZWja4dJRkFsKQ=")},
+	})
+
+	if _, err := l.SaslBind(NewSaslBindRequest(m, nil)); err == nil {
+		t.Fatal("expected the bind to fail on a bad server signature")
+	}
+}
+
+func TestSaslBindSuccessWithoutServerVerification(t *testing.T) {
+	scram := NewSaslScramSHA256("", "user", "pencil").(*saslScram)
+	scram.cnonce = fixedNonce("rOprNGfwEbeRWgbNEkqO")
+	digest := NewSaslDigestMD5("", "chris", "secret", "elwood.innosoft.com").(*saslDigestMD5)
+	digest.service = "imap"
+	digest.cnonce = fixedNonce("OA6MHXh6VqTrRk")
+
+	testcases := []struct {
+		mechanism SaslMechanism
+		name      string
+		steps     []saslStep
+	}{
+		{scram, "SCRAM-SHA-256", []saslStep{
+			{"n,,n=user,r=rOprNGfwEbeRWgbNEkqO", LDAPResultSaslBindInProgress, []byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")},
+			{"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", LDAPResultSuccess, nil},
+		}},
+		{digest, "DIGEST-MD5", []saslStep{
+			{"", LDAPResultSaslBindInProgress, []byte(`realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",qop="auth",algorithm=md5-sess,charset=utf-8`)},
+			{`charset=utf-8,username="chris",realm="elwood.innosoft.com",nonce="OA6MG9tEQGm2hh",nc=00000001,cnonce="OA6MHXh6VqTrRk",digest-uri="imap/elwood.innosoft.com",response=d388dad90d4bbd760a152321f2143af7,qop=auth`,
+				LDAPResultSuccess, nil},
+		}},
+	}
+
+	for _, testcase := range testcases {
+		l, server := newPipeConn()
+		go serveSasl(t, server, testcase.name, testcase.steps)
+		if _, err := l.SaslBind(NewSaslBindRequest(testcase.mechanism, nil)); err == nil {
+			t.Errorf("%s: expected the bind to fail without server verification", testcase.name)
+		}
+		l.Close()
+		server.Close()
+	}
+}
+
+func TestSaslBindInvalidCredentials(t *testing.T) {
+	m := NewSaslScramSHA1("", "user", "wrong").(*saslScram)
+	m.cnonce = fixedNonce("fyko+d2lbbFgONRv9qkxdawL")
+
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	go serveSasl(t, server, "SCRAM-SHA-1", []saslStep{
+		{"n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL", LDAPResultSaslBindInProgress, []byte("r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096")},
+		{"c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=GEGNAnqQMyjrGvb9q0apYc30afQ=", LDAPResultInvalidCredentials, []byte("e=invalid-proof")},
+	})
+
+	_, err := l.SaslBind(NewSaslBindRequest(m, nil))
+	if !IsErrorWithCode(err, LDAPResultInvalidCredentials) {
+		t.Fatalf("expected LDAPResultInvalidCredentials, got %v", err)
+	}
+}
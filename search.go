@@ -60,7 +60,7 @@
 package ldap
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"strings"
 
@@ -161,7 +161,8 @@ func (e *EntryAttribute) PrettyPrint(indent int) {
 }
 
 type SearchResult struct {
-	Entries   []*Entry
+	Entries []*Entry
+	// Referrals holds the first URL of each search result reference.
 	Referrals []string
 	Controls  []Control
 	Cookie    []byte
@@ -236,176 +237,109 @@ func NewSearchRequest(
 }
 
 func (l *Conn) SearchWithPaging(searchRequest *SearchRequest, pagingSize uint32) (*SearchResult, error) {
-	if searchRequest.Controls == nil {
-		searchRequest.Controls = make([]Control, 0)
-	}
-
-	pagingControl := NewControlPaging(pagingSize)
-	searchRequest.Controls = append(searchRequest.Controls, pagingControl)
-	searchResult := new(SearchResult)
-	for {
-		result, err := l.Search(searchRequest)
-		l.Debug.Printf("Looking for Paging Control...")
-		if err != nil {
-			return searchResult, err
-		}
-		if result == nil {
-			return searchResult, NewError(ErrorNetwork, errors.New("ldap: packet not received"))
-		}
-
-		for _, entry := range result.Entries {
-			searchResult.Entries = append(searchResult.Entries, entry)
-		}
-		for _, referral := range result.Referrals {
-			searchResult.Referrals = append(searchResult.Referrals, referral)
-		}
-		for _, control := range result.Controls {
-			searchResult.Controls = append(searchResult.Controls, control)
-		}
+	return l.SearchWithPagingContext(context.Background(), searchRequest, pagingSize)
+}
 
-		l.Debug.Printf("Looking for Paging Control...")
-		pagingResult := FindControl(result.Controls, ControlTypePaging)
-		if pagingResult == nil {
-			pagingControl = nil
-			l.Debug.Printf("Could not find paging control.  Breaking...")
-			break
-		}
+// SearchWithPagingContext is like SearchWithPaging, but stops and abandons
+// the outstanding page request when ctx is done.
+func (l *Conn) SearchWithPagingContext(ctx context.Context, searchRequest *SearchRequest, pagingSize uint32) (*SearchResult, error) {
+	paged := l.PagedSearch(ctx, searchRequest, pagingSize)
+	defer paged.Close()
 
-		cookie := pagingResult.(*ControlPaging).Cookie
-		if len(cookie) == 0 {
-			pagingControl = nil
-			l.Debug.Printf("Could not find cookie.  Breaking...")
-			break
-		}
-		pagingControl.SetCookie(cookie)
-	}
-
-	if pagingControl != nil {
-		l.Debug.Printf("Abandoning Paging...")
-		pagingControl.PagingSize = 0
-		l.Search(searchRequest)
+	searchResult := new(SearchResult)
+	for paged.Next() {
+		result := paged.Page()
+		searchResult.Entries = append(searchResult.Entries, result.Entries...)
+		searchResult.Referrals = append(searchResult.Referrals, result.Referrals...)
+		searchResult.Controls = append(searchResult.Controls, result.Controls...)
 	}
-
-	return searchResult, nil
+	return searchResult, paged.Err()
 }
 
 func (l *Conn) Search(searchRequest *SearchRequest) (*SearchResult, error) {
-	messageID := l.nextMessageID()
-	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
-	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
-	// encode search request
-	encodedSearchRequest, err := searchRequest.encode()
-	if err != nil {
-		return nil, err
-	}
-	packet.AppendChild(encodedSearchRequest)
-	// encode search controls
-	if searchRequest.Controls != nil {
-		packet.AppendChild(encodeControls(searchRequest.Controls))
-	}
+	return l.SearchContext(context.Background(), searchRequest)
+}
 
-	l.Debug.PrintPacket(packet)
+// SearchContext is like Search, but gives up waiting for further results
+// and abandons the search when ctx is done.
+func (l *Conn) SearchContext(ctx context.Context, searchRequest *SearchRequest) (*SearchResult, error) {
+	return l.searchWithCallbacks(ctx, searchRequest, searchCallbacks{})
+}
 
-	channel, err := l.sendMessage(packet)
-	if err != nil {
-		return nil, err
-	}
-	if channel == nil {
-		return nil, NewError(ErrorNetwork, errors.New("ldap: could not send message"))
-	}
-	defer l.finishMessage(messageID)
+// searchCallbacks receive the results of a single search instead of the
+// SearchResult. Unset callbacks leave their results in the SearchResult.
+type searchCallbacks struct {
+	entry    func(entry *Entry, controls []Control) error
+	cookie   func([]byte) error
+	syncInfo func(*SyncInfo) error
+	referral func([]string) error
+}
+
+func (l *Conn) searchWithCallbacks(ctx context.Context, searchRequest *SearchRequest, callbacks searchCallbacks) (*SearchResult, error) {
+	response := l.SearchAsync(ctx, searchRequest)
+	defer response.Close()
 
 	result := &SearchResult{
 		Entries:   make([]*Entry, 0),
 		Referrals: make([]string, 0),
 		Controls:  make([]Control, 0)}
 
-	foundSearchResultDone := false
-	for !foundSearchResultDone {
-		l.Debug.Printf("%d: waiting for response", messageID)
-		packet = <-channel
-		l.Debug.Printf("%d: got response %p", messageID, packet)
-		if packet == nil {
-			return nil, NewError(ErrorNetwork, errors.New("ldap: could not retrieve message"))
-		}
-
-		if l.Debug {
-			if err := addLDAPDescriptions(packet); err != nil {
-				return nil, err
-			}
-			ber.PrintPacket(packet)
-		}
-
-		switch packet.Children[1].Tag {
-		case 4:
-			entry := new(Entry)
-			entry.DN = packet.Children[1].Children[0].Value.(string)
-			for _, child := range packet.Children[1].Children[1].Children {
-				attr := new(EntryAttribute)
-				attr.Name = child.Children[0].Value.(string)
-				for _, value := range child.Children[1].Children {
-					attr.Values = append(attr.Values, value.Value.(string))
-					attr.ByteValues = append(attr.ByteValues, value.ByteValue)
-				}
-				entry.Attributes = append(entry.Attributes, attr)
-			}
-
-			entryControls := make([]Control, 0)
-			if len(packet.Children) == 3 {
-				for _, child := range packet.Children[2].Children {
-					entryControls = append(entryControls, DecodeControl(child))
-				}
-			}
+	for response.Next() {
+		switch {
+		case response.Entry() != nil:
+			entry, entryControls := response.Entry(), response.Controls()
 
 			// During Content Sync, this function will run for indefintie periods of time,
 			// so it's dangerous to accumulate all results in the lists.  Use the callbacks instead
 			// to deliver results to the caller.
-			if l.entryCallback != nil {
-				if err := l.entryCallback(entry, entryControls); err != nil {
+			if callbacks.entry != nil {
+				if err := callbacks.entry(entry, entryControls); err != nil {
 					return nil, fmt.Errorf("entryCallback error, terminating search:%v", err)
 				}
 			} else {
 				result.Entries = append(result.Entries, entry)
 				result.Controls = append(result.Controls, entryControls...)
 			}
-
-		case 5:
-			resultCode, resultDescription := getLDAPResultCode(packet)
-			if resultCode != 0 {
-				return result, NewError(resultCode, errors.New(resultDescription))
-			}
-			if len(packet.Children) == 3 {
-				for _, child := range packet.Children[2].Children {
-					result.Controls = append(result.Controls, DecodeControl(child))
-				}
-			}
-			foundSearchResultDone = true
-		case 19:
-			if l.cookieCallback != nil {
-				if err := l.referalCallback(packet.Children[1].Children[0].Value.(string)); err != nil {
+		case response.Referrals() != nil:
+			if callbacks.referral != nil {
+				if err := callbacks.referral(response.Referrals()); err != nil {
 					return nil, fmt.Errorf("referalCallback error, terminating search:%v", err)
 				}
 			} else {
-				result.Referrals = append(result.Referrals, packet.Children[1].Children[0].Value.(string))
+				result.Referrals = append(result.Referrals, response.Referral())
 			}
-		case 25:
-			if string(packet.Children[1].Children[0].Data.Bytes()) == ControlTypeContentSyncInfo {
-				child := ber.DecodePacket(packet.Children[1].Children[1].Data.Bytes())
-				// TODO: RFC 4533 -- 2.5. Sync Info Message -- more choices are possible
-				if len(child.Children) > 0 {
-					if l.cookieCallback != nil {
-						if err := l.cookieCallback(child.Children[0].ByteValue); err != nil {
+		case response.Intermediate() != nil:
+			intermediate := response.Intermediate()
+			if intermediate.Name == ControlTypeContentSyncInfo {
+				info, err := DecodeSyncInfo(intermediate.Value)
+				if err != nil {
+					return nil, NewError(ErrorUnexpectedResponse, err)
+				}
+				if callbacks.syncInfo != nil {
+					if err := callbacks.syncInfo(info); err != nil {
+						return nil, fmt.Errorf("syncInfoCallback error, terminating search:%v", err)
+					}
+				}
+				if info.Cookie != nil {
+					if callbacks.cookie != nil {
+						if err := callbacks.cookie(info.Cookie); err != nil {
 							return nil, fmt.Errorf("cookieCallback error, terminating search:%v", err)
 						}
 					} else {
-						result.Cookie = child.Children[0].ByteValue
+						result.Cookie = info.Cookie
 					}
 				}
 			}
-		default:
-			l.Debug.Printf("%d: unknown tag: %v", messageID, packet.Children[1].Tag)
 		}
 	}
-	l.Debug.Printf("%d: returning", messageID)
+	if err := response.Err(); err != nil {
+		if response.finished {
+			return result, err
+		}
+		return nil, err
+	}
+
+	result.Controls = append(result.Controls, response.Controls()...)
+	l.Debug.Printf("%d: returning", response.MessageID())
 	return result, nil
 }
@@ -0,0 +1,145 @@
+// File contains server discovery via DNS SRV records
+//
+// https://tools.ietf.org/html/rfc2782
+//
+//   _Service._Proto.Name TTL Class SRV Priority Weight Port Target
+//
+
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SRVResolver looks up SRV records. It is implemented by *net.Resolver.
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// SRVDiscovery finds the LDAP servers of a domain via DNS SRV records,
+// e.g. _ldap._tcp.example.com.
+type SRVDiscovery struct {
+	// Resolver looks up the records. If nil, net.DefaultResolver is used.
+	Resolver SRVResolver
+
+	// Service is the service name of the records, "ldap" if empty. The
+	// servers of "ldaps" records are returned as ldaps:// URLs, all others
+	// as ldap:// URLs.
+	Service string
+
+	// intn returns a random number in [0, n), rand.Intn by default.
+	intn func(n int) int
+}
+
+// URLs returns the URLs of the servers of domain in the order they should
+// be tried, i.e. by priority and randomly by weight within a priority as
+// described in RFC 2782. The result can be used as the URLs of a
+// FailoverConfig or returned from its Discover function.
+func (d *SRVDiscovery) URLs(ctx context.Context, domain string) ([]string, error) {
+	var resolver SRVResolver = net.DefaultResolver
+	if d.Resolver != nil {
+		resolver = d.Resolver
+	}
+	service := d.Service
+	if service == "" {
+		service = "ldap"
+	}
+	scheme := "ldap"
+	if strings.ToLower(service) == "ldaps" {
+		scheme = "ldaps"
+	}
+
+	_, records, err := resolver.LookupSRV(ctx, service, "tcp", domain)
+	if err != nil {
+		return nil, NewError(ErrorNetwork, err)
+	}
+	// A single record with target "." means the service is not available
+	if len(records) == 0 || (len(records) == 1 && records[0].Target == ".") {
+		return nil, NewError(ErrorNetwork, fmt.Errorf("ldap: no %s servers for %s", service, domain))
+	}
+
+	intn := d.intn
+	if intn == nil {
+		intn = rand.Intn
+	}
+
+	var urls []string
+	for _, record := range orderSRV(records, intn) {
+		host := strings.TrimSuffix(record.Target, ".")
+		if host == "" {
+			continue
+		}
+		u := &LDAPURL{Scheme: scheme, Host: net.JoinHostPort(host, strconv.Itoa(int(record.Port)))}
+		urls = append(urls, u.String())
+	}
+	if len(urls) == 0 {
+		return nil, NewError(ErrorNetwork, errors.New("ldap: no usable SRV records"))
+	}
+	return urls, nil
+}
+
+// orderSRV sorts records by priority and orders the records of the same
+// priority with the weighted random selection of RFC 2782.
+func orderSRV(records []*net.SRV, intn func(n int) int) []*net.SRV {
+	sorted := make([]*net.SRV, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	ordered := make([]*net.SRV, 0, len(sorted))
+	for i := 0; i < len(sorted); {
+		j := i
+		for j < len(sorted) && sorted[j].Priority == sorted[i].Priority {
+			j++
+		}
+		ordered = append(ordered, orderByWeight(sorted[i:j], intn)...)
+		i = j
+	}
+	return ordered
+}
+
+// orderByWeight repeatedly selects a record with a probability
+// proportional to its weight. Records with weight 0 are put first, so
+// they have a small chance of being selected when there are others.
+func orderByWeight(records []*net.SRV, intn func(n int) int) []*net.SRV {
+	remaining := make([]*net.SRV, 0, len(records))
+	for _, record := range records {
+		if record.Weight == 0 {
+			remaining = append(remaining, record)
+		}
+	}
+	for _, record := range records {
+		if record.Weight != 0 {
+			remaining = append(remaining, record)
+		}
+	}
+
+	ordered := make([]*net.SRV, 0, len(records))
+	for len(remaining) > 0 {
+		total := 0
+		for _, record := range remaining {
+			total += int(record.Weight)
+		}
+		n := intn(total + 1)
+
+		selected, sum := len(remaining)-1, 0
+		for i, record := range remaining {
+			sum += int(record.Weight)
+			if sum >= n {
+				selected = i
+				break
+			}
+		}
+		ordered = append(ordered, remaining[selected])
+		remaining = append(remaining[:selected], remaining[selected+1:]...)
+	}
+	return ordered
+}
@@ -0,0 +1,241 @@
+package ldap
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// stubDNS is a DNS server on a local UDP port answering SRV queries from
+// a fixed set of records.
+type stubDNS struct {
+	conn    net.PacketConn
+	records map[string][]*net.SRV
+}
+
+func newStubDNS(t *testing.T, records map[string][]*net.SRV) *stubDNS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubDNS{conn: conn, records: records}
+	go s.serve()
+	return s
+}
+
+// resolver returns a resolver that sends all queries to the stub server.
+func (s *stubDNS) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *stubDNS) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if response := s.answer(buf[:n]); response != nil {
+			s.conn.WriteTo(response, addr)
+		}
+	}
+}
+
+func (s *stubDNS) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// question name, type and class
+	var labels []string
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		l := int(query[i])
+		if i+1+l > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[i+1:i+1+l]))
+		i += 1 + l
+	}
+	end := i + 5
+	if end > len(query) {
+		return nil
+	}
+	name := strings.ToLower(strings.Join(labels, "."))
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+
+	var records []*net.SRV
+	if qtype == 33 {
+		records = s.records[name]
+	}
+	_, known := s.records[name]
+
+	response := make([]byte, 12, 512)
+	copy(response, query[:2])
+	flags := uint16(0x8180)
+	if !known {
+		flags |= 3 // NXDOMAIN
+	}
+	binary.BigEndian.PutUint16(response[2:], flags)
+	binary.BigEndian.PutUint16(response[4:], 1)
+	binary.BigEndian.PutUint16(response[6:], uint16(len(records)))
+	response = append(response, query[12:end]...)
+
+	for _, record := range records {
+		var rdata []byte
+		rdata = appendUint16(rdata, record.Priority)
+		rdata = appendUint16(rdata, record.Weight)
+		rdata = appendUint16(rdata, record.Port)
+		for _, label := range strings.Split(strings.TrimSuffix(record.Target, "."), ".") {
+			rdata = append(rdata, byte(len(label)))
+			rdata = append(rdata, label...)
+		}
+		rdata = append(rdata, 0)
+
+		response = append(response, 0xc0, 12) // pointer to the question name
+		response = appendUint16(response, 33)
+		response = appendUint16(response, 1)
+		response = appendUint32(response, 300)
+		response = appendUint16(response, uint16(len(rdata)))
+		response = append(response, rdata...)
+	}
+	return response
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func TestSRVDiscovery(t *testing.T) {
+	dns := newStubDNS(t, map[string][]*net.SRV{
+		"_ldap._tcp.example.com": {
+			{Target: "ldap3.example.com.", Port: 389, Priority: 20, Weight: 0},
+			{Target: "ldap1.example.com.", Port: 389, Priority: 0, Weight: 10},
+			{Target: "ldap2.example.com.", Port: 3389, Priority: 10, Weight: 0},
+		},
+		"_ldaps._tcp.example.com": {
+			{Target: "ldap1.example.com.", Port: 636, Priority: 0, Weight: 0},
+		},
+		"_ldap._tcp.empty.example.com": {
+			{Target: ".", Port: 0},
+		},
+	})
+	defer dns.conn.Close()
+
+	d := &SRVDiscovery{Resolver: dns.resolver()}
+	urls, err := d.URLs(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"ldap://ldap1.example.com:389", "ldap://ldap2.example.com:3389", "ldap://ldap3.example.com:389"}
+	if !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expected %v, got %v", expected, urls)
+	}
+
+	d = &SRVDiscovery{Resolver: dns.resolver(), Service: "ldaps"}
+	urls, err = d.URLs(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"ldaps://ldap1.example.com:636"}; !reflect.DeepEqual(urls, expected) {
+		t.Errorf("expected %v, got %v", expected, urls)
+	}
+
+	d = &SRVDiscovery{Resolver: dns.resolver()}
+	for _, domain := range []string{"empty.example.com", "unknown.example.com"} {
+		if _, err := d.URLs(context.Background(), domain); !IsErrorWithCode(err, ErrorNetwork) {
+			t.Errorf("%s: expected a network error, got %v", domain, err)
+		}
+	}
+}
+
+func TestOrderSRV(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "b", Priority: 1, Weight: 10},
+		{Target: "c", Priority: 1, Weight: 30},
+		{Target: "a", Priority: 0, Weight: 0},
+		{Target: "z", Priority: 1, Weight: 0},
+	}
+	testcases := []struct {
+		random   []int
+		expected []string
+	}{
+		// running sums for priority 1 are z=0, b=10, c=40
+		{[]int{0, 0, 0, 0}, []string{"a", "z", "b", "c"}},
+		{[]int{0, 11, 0, 0}, []string{"a", "c", "z", "b"}},
+		{[]int{0, 5, 0, 0}, []string{"a", "b", "z", "c"}},
+		{[]int{0, 40, 1, 0}, []string{"a", "c", "b", "z"}},
+	}
+	for _, testcase := range testcases {
+		random := testcase.random
+		intn := func(n int) int {
+			r := random[0]
+			random = random[1:]
+			if r >= n {
+				t.Fatalf("random number %d out of range %d", r, n)
+			}
+			return r
+		}
+
+		var targets []string
+		for _, record := range orderSRV(records, intn) {
+			targets = append(targets, record.Target)
+		}
+		if !reflect.DeepEqual(targets, testcase.expected) {
+			t.Errorf("%v: expected %v, got %v", testcase.random, testcase.expected, targets)
+		}
+	}
+}
+
+// fakeResolver returns fixed SRV records.
+type fakeResolver []*net.SRV
+
+func (r fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return "_" + service + "._" + proto + "." + name, r, nil
+}
+
+func TestFailoverClientDiscover(t *testing.T) {
+	s := newTestServer(t, func(conn int, request *ber.Packet, server net.Conn) bool {
+		answerSearch(request, server)
+		return true
+	})
+	defer s.listener.Close()
+
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	p, _ := net.LookupPort("tcp", port)
+	d := &SRVDiscovery{Resolver: fakeResolver{
+		{Target: "127.0.0.1.", Port: uint16(p), Priority: 10},
+		{Target: "localhost.invalid.", Port: 389, Priority: 0},
+	}}
+
+	c, err := NewFailoverClient(FailoverConfig{
+		Discover: func(ctx context.Context) ([]string, error) {
+			return d.URLs(ctx, "example.com")
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Search(NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(cn=test)", nil, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "ldap://127.0.0.1:" + port; c.URL() != expected {
+		t.Errorf("expected to be connected to %s, got %s", expected, c.URL())
+	}
+}
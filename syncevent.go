@@ -0,0 +1,124 @@
+package ldap
+
+import (
+	enchex "encoding/hex"
+	"fmt"
+)
+
+// Entry states of the Sync State control -- RFC 4533, section 2.3
+const (
+	EntryStatePresent = 0
+	EntryStateAdd     = 1
+	EntryStateModify  = 2
+	EntryStateDelete  = 3
+)
+
+// SyncState is the state of an entry reported by a content
+// synchronization.
+type SyncState uint32
+
+// Sync states, with the values of the EntryState* constants
+const (
+	SyncStatePresent SyncState = EntryStatePresent
+	SyncStateAdd     SyncState = EntryStateAdd
+	SyncStateModify  SyncState = EntryStateModify
+	SyncStateDelete  SyncState = EntryStateDelete
+)
+
+var syncStateNames = map[SyncState]string{
+	SyncStatePresent: "present",
+	SyncStateAdd:     "add",
+	SyncStateModify:  "modify",
+	SyncStateDelete:  "delete",
+}
+
+func (s SyncState) String() string {
+	if name, ok := syncStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("SyncState(%d)", uint32(s))
+}
+
+// UUID is the entryUUID of an entry as sent by a content synchronization.
+type UUID [16]byte
+
+// ParseUUID returns the UUID in b, which must be 16 bytes long.
+func ParseUUID(b []byte) (UUID, error) {
+	var u UUID
+	if len(b) != len(u) {
+		return u, fmt.Errorf("ldap: invalid UUID of %d bytes", len(b))
+	}
+	copy(u[:], b)
+	return u, nil
+}
+
+// String returns the UUID in its textual form, e.g.
+// "0ff0d3a8-a5fb-1035-8f7b-bdc5c3a0e30e".
+func (u UUID) String() string {
+	var buf [36]byte
+	enchex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	enchex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	enchex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	enchex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	enchex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// SyncEvent is a change reported by a content synchronization.
+type SyncEvent struct {
+	State SyncState
+
+	// Entry is the entry with its attributes. It is nil for entries only
+	// listed by UUID in a Sync Info Message, and has no attributes for
+	// deleted and present entries.
+	Entry *Entry
+
+	UUID UUID
+
+	// Cookie is the cookie sent with the change, if any.
+	Cookie []byte
+}
+
+// SyncEventCallback receives the changes of a content synchronization.
+type SyncEventCallback func(*SyncEvent) error
+
+func newSyncEvent(entry *Entry, control *ControlContentSyncState) (*SyncEvent, error) {
+	uuid, err := ParseUUID(control.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	event := &SyncEvent{
+		State: SyncState(control.State),
+		Entry: entry,
+		UUID:  uuid,
+	}
+	if len(control.Cookie) > 0 {
+		event.Cookie = control.Cookie
+	}
+	return event, nil
+}
+
+// syncInfoEvents returns the events for the entries listed in a syncIdSet
+// Sync Info Message.
+func syncInfoEvents(info *SyncInfo) ([]*SyncEvent, error) {
+	if info.Type != SyncInfoIDSet {
+		return nil, nil
+	}
+	state := SyncStatePresent
+	if info.RefreshDeletes {
+		state = SyncStateDelete
+	}
+	events := make([]*SyncEvent, 0, len(info.UUIDs))
+	for _, b := range info.UUIDs {
+		uuid, err := ParseUUID(b)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &SyncEvent{State: state, UUID: uuid, Cookie: info.Cookie})
+	}
+	return events, nil
+}
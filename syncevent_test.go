@@ -0,0 +1,81 @@
+package ldap
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+func TestUUID(t *testing.T) {
+	u, err := ParseUUID([]byte{0x0f, 0xf0, 0xd3, 0xa8, 0xa5, 0xfb, 0x10, 0x35, 0x8f, 0x7b, 0xbd, 0xc5, 0xc3, 0xa0, 0xe3, 0x0e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := u.String(), "0ff0d3a8-a5fb-1035-8f7b-bdc5c3a0e30e"; got != want {
+		t.Errorf("got %s, expected %s", got, want)
+	}
+	if _, err := ParseUUID([]byte("short")); err == nil {
+		t.Error("expected an error for a short UUID")
+	}
+}
+
+func TestSyncStateString(t *testing.T) {
+	for state, want := range map[SyncState]string{
+		SyncStatePresent: "present",
+		SyncStateAdd:     "add",
+		SyncStateModify:  "modify",
+		SyncStateDelete:  "delete",
+		SyncState(7):     "SyncState(7)",
+	} {
+		if got := state.String(); got != want {
+			t.Errorf("got %s, expected %s", got, want)
+		}
+	}
+}
+
+func TestContentSyncEvents(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	var events []SyncEvent
+	done := make(chan error)
+	go func() {
+		_, err := l.ContentSync(context.Background(), GetContentSyncRequest("dc=example,dc=com", "(objectClass=*)", nil),
+			ContentSyncOptions{Event: func(event *SyncEvent) error {
+				events = append(events, *event)
+				return nil
+			}})
+		done <- err
+	}()
+	messageID := (<-requests).Children[0].Value.(int64)
+
+	writeResponse(t, server, messageID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"),
+		&ControlContentSyncState{State: EntryStateModify, Uuid: []byte("0123456789abcdef"), Cookie: []byte("c1")})
+	idSet := newSyncInfo(SyncInfoIDSet, []byte("c2"))
+	uuids := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Sync UUIDs")
+	uuids.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "fedcba9876543210", "UUID"))
+	idSet.AppendChild(uuids)
+	writeResponse(t, server, messageID, newSyncInfoResponse(idSet))
+	writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, expected 2", len(events))
+	}
+	first, second := events[0], events[1]
+	if first.State != SyncStateModify || first.Entry == nil || first.Entry.DN != "cn=a,dc=example,dc=com" ||
+		string(first.UUID[:]) != "0123456789abcdef" || string(first.Cookie) != "c1" {
+		t.Errorf("unexpected event %+v", first)
+	}
+	want := SyncEvent{State: SyncStatePresent, Cookie: []byte("c2")}
+	copy(want.UUID[:], "fedcba9876543210")
+	if !reflect.DeepEqual(second, want) {
+		t.Errorf("got %+v, expected %+v", second, want)
+	}
+}
@@ -0,0 +1,122 @@
+// File contains Sync Info Message functionality
+//
+// https://tools.ietf.org/html/rfc4533#section-2.5
+//
+//   syncInfoValue ::= CHOICE {
+//        newcookie      [0] syncCookie,
+//        refreshDelete  [1] SEQUENCE {
+//            cookie         syncCookie OPTIONAL,
+//            refreshDone    BOOLEAN DEFAULT TRUE
+//        },
+//        refreshPresent [2] SEQUENCE {
+//            cookie         syncCookie OPTIONAL,
+//            refreshDone    BOOLEAN DEFAULT TRUE
+//        },
+//        syncIdSet      [3] SEQUENCE {
+//            cookie         syncCookie OPTIONAL,
+//            refreshDeletes BOOLEAN DEFAULT FALSE,
+//            syncUUIDs      SET OF syncUUID
+//        }
+//   }
+//
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// Sync Info Message choices
+const (
+	SyncInfoNewCookie      = 0
+	SyncInfoRefreshDelete  = 1
+	SyncInfoRefreshPresent = 2
+	SyncInfoIDSet          = 3
+)
+
+// SyncInfoMap contains human readable descriptions of the Sync Info
+// Message choices
+var SyncInfoMap = map[int]string{
+	SyncInfoNewCookie:      "New Cookie",
+	SyncInfoRefreshDelete:  "Refresh Delete",
+	SyncInfoRefreshPresent: "Refresh Present",
+	SyncInfoIDSet:          "Sync ID Set",
+}
+
+// SyncInfo is a Sync Info Message sent by the server during a content
+// synchronization.
+//
+// A refreshDelete or refreshPresent message ends the respective phase of
+// the refresh if RefreshDone is set. At the end of a present phase, the
+// client deletes all entries the server did not report as present.
+//
+// A syncIdSet message lists entries by UUID: the entries were deleted if
+// RefreshDeletes is set, otherwise they are present.
+type SyncInfo struct {
+	// Type is one of the SyncInfo* constants
+	Type           int
+	Cookie         []byte
+	RefreshDone    bool
+	RefreshDeletes bool
+	UUIDs          [][]byte
+}
+
+// SyncInfoCallback receives the Sync Info Messages of a content
+// synchronization.
+type SyncInfoCallback func(*SyncInfo) error
+
+// DecodeSyncInfo decodes the value of a Sync Info Message.
+func DecodeSyncInfo(value []byte) (*SyncInfo, error) {
+	packet, err := ber.DecodePacketErr(value)
+	if err != nil {
+		return nil, err
+	}
+	if packet.ClassType != ber.ClassContext {
+		return nil, errors.New("ldap: invalid sync info message")
+	}
+
+	info := &SyncInfo{Type: int(packet.Tag)}
+	switch info.Type {
+	case SyncInfoNewCookie:
+		info.Cookie = packet.Data.Bytes()
+		return info, nil
+	case SyncInfoRefreshDelete, SyncInfoRefreshPresent:
+		info.RefreshDone = true
+	case SyncInfoIDSet:
+	default:
+		return nil, fmt.Errorf("ldap: unknown sync info message %d", packet.Tag)
+	}
+
+	for _, child := range packet.Children {
+		if child.ClassType != ber.ClassUniversal {
+			return nil, errors.New("ldap: invalid sync info message")
+		}
+		switch child.Tag {
+		case ber.TagOctetString:
+			info.Cookie = child.Data.Bytes()
+		case ber.TagBoolean:
+			flag, ok := child.Value.(bool)
+			if !ok {
+				return nil, errors.New("ldap: invalid sync info message")
+			}
+			if info.Type == SyncInfoIDSet {
+				info.RefreshDeletes = flag
+			} else {
+				info.RefreshDone = flag
+			}
+		case ber.TagSet:
+			if info.Type != SyncInfoIDSet {
+				return nil, errors.New("ldap: invalid sync info message")
+			}
+			for _, uuid := range child.Children {
+				info.UUIDs = append(info.UUIDs, uuid.Data.Bytes())
+			}
+		default:
+			return nil, errors.New("ldap: invalid sync info message")
+		}
+	}
+	return info, nil
+}
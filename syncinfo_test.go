@@ -0,0 +1,195 @@
+package ldap
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// newSyncInfo encodes a Sync Info Message of the given choice. For the
+// sequence choices, children are appended to the returned packet.
+func newSyncInfo(choice int, cookie []byte) *ber.Packet {
+	if choice == SyncInfoNewCookie {
+		info := ber.Encode(ber.ClassContext, ber.TypePrimitive, ber.Tag(choice), nil, "New Cookie")
+		info.Data.Write(cookie)
+		return info
+	}
+	info := ber.Encode(ber.ClassContext, ber.TypeConstructed, ber.Tag(choice), nil, SyncInfoMap[choice])
+	if cookie != nil {
+		info.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(cookie), "Cookie"))
+	}
+	return info
+}
+
+// newSyncInfoResponse wraps a Sync Info Message in an intermediate
+// response.
+func newSyncInfoResponse(info *ber.Packet) *ber.Packet {
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ApplicationIntermediateResponse, nil, "Intermediate Response")
+	response.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, ControlTypeContentSyncInfo, "Response Name"))
+	value := ber.Encode(ber.ClassContext, ber.TypePrimitive, 1, nil, "Response Value")
+	value.Data.Write(info.Bytes())
+	response.AppendChild(value)
+	return response
+}
+
+func TestDecodeSyncInfo(t *testing.T) {
+	refreshDelete := newSyncInfo(SyncInfoRefreshDelete, []byte("c1"))
+	refreshDelete.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, false, "Refresh Done"))
+
+	idSet := newSyncInfo(SyncInfoIDSet, nil)
+	idSet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, true, "Refresh Deletes"))
+	uuids := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Sync UUIDs")
+	uuids.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "0123456789abcdef", "UUID"))
+	uuids.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "fedcba9876543210", "UUID"))
+	idSet.AppendChild(uuids)
+
+	tests := []struct {
+		name string
+		info *ber.Packet
+		want *SyncInfo
+	}{
+		{"newcookie", newSyncInfo(SyncInfoNewCookie, []byte("c0")),
+			&SyncInfo{Type: SyncInfoNewCookie, Cookie: []byte("c0")}},
+		{"refreshDelete", refreshDelete,
+			&SyncInfo{Type: SyncInfoRefreshDelete, Cookie: []byte("c1")}},
+		{"refreshPresent defaults", newSyncInfo(SyncInfoRefreshPresent, nil),
+			&SyncInfo{Type: SyncInfoRefreshPresent, RefreshDone: true}},
+		{"syncIdSet", idSet,
+			&SyncInfo{Type: SyncInfoIDSet, RefreshDeletes: true, UUIDs: [][]byte{[]byte("0123456789abcdef"), []byte("fedcba9876543210")}}},
+	}
+	for _, test := range tests {
+		got, err := DecodeSyncInfo(test.info.Bytes())
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, expected %+v", test.name, got, test.want)
+		}
+	}
+
+	if _, err := DecodeSyncInfo(newSyncInfo(5, nil).Bytes()); err == nil {
+		t.Error("expected an error for an unknown choice")
+	}
+}
+
+func TestContentSyncInfo(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	type event struct {
+		dn    string
+		state uint32
+	}
+	var events []event
+	var cookies []string
+	var infos []*SyncInfo
+
+	done := make(chan error)
+	go func() {
+		_, err := l.ContentSync(context.Background(), GetContentSyncRequest("dc=example,dc=com", "(objectClass=*)", nil), ContentSyncOptions{
+			Entry: func(entry *Entry, uuid []byte, state uint32) error {
+				events = append(events, event{entry.DN, state})
+				return nil
+			},
+			Cookie: func(cookie []byte) error {
+				cookies = append(cookies, string(cookie))
+				return nil
+			},
+			SyncInfo: func(info *SyncInfo) error {
+				infos = append(infos, info)
+				return nil
+			},
+		})
+		done <- err
+	}()
+	messageID := (<-requests).Children[0].Value.(int64)
+
+	writeResponse(t, server, messageID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"),
+		&ControlContentSyncState{State: EntryStatePresent, Uuid: []byte("0123456789abcdef")})
+	writeResponse(t, server, messageID, newSyncInfoResponse(newSyncInfo(SyncInfoRefreshPresent, []byte("c1"))))
+	writeResponse(t, server, messageID, newSearchEntry("cn=b,dc=example,dc=com", "cn", "b"),
+		&ControlContentSyncState{State: EntryStateAdd, Uuid: []byte("fedcba9876543210"), Cookie: []byte("c2")})
+	writeResponse(t, server, messageID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []event{{"cn=a,dc=example,dc=com", EntryStatePresent}, {"cn=b,dc=example,dc=com", EntryStateAdd}}; !reflect.DeepEqual(events, want) {
+		t.Errorf("got events %v, expected %v", events, want)
+	}
+	if want := []string{"c1", "c2"}; !reflect.DeepEqual(cookies, want) {
+		t.Errorf("got cookies %q, expected %q", cookies, want)
+	}
+	if len(infos) != 1 || infos[0].Type != SyncInfoRefreshPresent || !infos[0].RefreshDone {
+		t.Errorf("unexpected sync info messages %+v", infos)
+	}
+}
+
+func TestSearchDuringContentSync(t *testing.T) {
+	l, server := newPipeConn()
+	defer l.Close()
+	defer server.Close()
+	requests := readRequests(server)
+
+	var mu sync.Mutex
+	var syncDNs []string
+	var syncInfos []*SyncInfo
+	syncDone := make(chan error)
+	go func() {
+		_, err := l.ContentSync(context.Background(), GetContentSyncRequest("dc=example,dc=com", "(objectClass=*)", nil), ContentSyncOptions{
+			Entry: func(entry *Entry, uuid []byte, state uint32) error {
+				mu.Lock()
+				syncDNs = append(syncDNs, entry.DN)
+				mu.Unlock()
+				return nil
+			},
+			SyncInfo: func(info *SyncInfo) error {
+				mu.Lock()
+				syncInfos = append(syncInfos, info)
+				mu.Unlock()
+				return nil
+			},
+		})
+		syncDone <- err
+	}()
+	syncID := (<-requests).Children[0].Value.(int64)
+
+	searchDone := make(chan *SearchResult)
+	go func() {
+		result, err := l.Search(NewSearchRequest("dc=example,dc=com", ScopeWholeSubtree, NeverDerefAliases, 0, 0, false, "(cn=b)", nil, nil))
+		if err != nil {
+			t.Error(err)
+		}
+		searchDone <- result
+	}()
+	searchID := (<-requests).Children[0].Value.(int64)
+
+	// The results of both searches interleave on the connection
+	writeResponse(t, server, searchID, newSearchEntry("cn=b,dc=example,dc=com", "cn", "b"))
+	writeResponse(t, server, syncID, newSearchEntry("cn=a,dc=example,dc=com", "cn", "a"),
+		&ControlContentSyncState{State: EntryStateAdd, Uuid: []byte("0123456789abcdef")})
+	writeResponse(t, server, searchID, newSyncInfoResponse(newSyncInfo(SyncInfoNewCookie, []byte("c2"))))
+	writeResponse(t, server, searchID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+	result := <-searchDone
+	writeResponse(t, server, syncID, newSyncInfoResponse(newSyncInfo(SyncInfoNewCookie, []byte("c1"))))
+	writeResponse(t, server, syncID, newResult(ApplicationSearchResultDone, LDAPResultSuccess, ""))
+	if err := <-syncDone; err != nil {
+		t.Fatal(err)
+	}
+
+	if result == nil || len(result.Entries) != 1 || result.Entries[0].DN != "cn=b,dc=example,dc=com" || string(result.Cookie) != "c2" {
+		t.Errorf("unexpected search result %+v", result)
+	}
+	if want := []string{"cn=a,dc=example,dc=com"}; !reflect.DeepEqual(syncDNs, want) {
+		t.Errorf("content sync got entries %q, expected %q", syncDNs, want)
+	}
+	if len(syncInfos) != 1 || string(syncInfos[0].Cookie) != "c1" {
+		t.Errorf("unexpected sync info messages %+v", syncInfos)
+	}
+}
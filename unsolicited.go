@@ -0,0 +1,135 @@
+// File contains unsolicited notification functionality
+//
+// https://tools.ietf.org/html/rfc4511#section-4.4
+//
+//   ExtendedResponse ::= [APPLICATION 24] SEQUENCE {
+//        COMPONENTS OF LDAPResult,
+//        responseName     [10] LDAPOID OPTIONAL,
+//        responseValue    [11] OCTET STRING OPTIONAL }
+//
+// Unsolicited notifications are extended responses with message ID 0.
+//
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// NoticeOfDisconnectionOID is the response name of the unsolicited
+// notification a server sends before it closes a connection.
+const NoticeOfDisconnectionOID = "1.3.6.1.4.1.1466.20036"
+
+// UnsolicitedNotification is an extended response the server sent without
+// a request.
+type UnsolicitedNotification struct {
+	ResultCode    uint16
+	MatchedDN     string
+	Diagnostic    string
+	ResponseName  string
+	ResponseValue []byte
+	Controls      []Control
+}
+
+// DialWithNotificationHandler sets a function that is called with every
+// unsolicited notification received on the connection, including the
+// notice of disconnection. It is called on a goroutine of its own, one
+// notification at a time in the order they arrived, so it may call Close.
+// Once the queue of the connection (see DialWithQueueSize) is full of
+// notifications the handler has not taken yet, reading from the connection
+// pauses until it catches up.
+func DialWithNotificationHandler(handler func(*UnsolicitedNotification)) DialOpt {
+	return func(dc *dialConfig) {
+		dc.notificationHandler = handler
+	}
+}
+
+// handleUnsolicited passes an unsolicited notification to the notification
+// handler. For a notice of disconnection it returns the error pending and
+// further operations fail with.
+func (l *Conn) handleUnsolicited(packet *ber.Packet) error {
+	n, err := decodeUnsolicitedNotification(packet)
+	if err != nil {
+		l.Debug.Printf("Received bad unsolicited notification: %s", err.Error())
+		l.Debug.PrintPacket(packet)
+		return nil
+	}
+	l.Debug.Printf("Received unsolicited notification %s", n.ResponseName)
+
+	if l.notificationHandler != nil {
+		l.notifyOnce.Do(func() {
+			l.notifications = make(chan *UnsolicitedNotification, l.queueSize)
+			go l.notify(l.notifications)
+		})
+		select {
+		case l.notifications <- n:
+		case <-l.closed:
+		}
+	}
+
+	if n.ResponseName != NoticeOfDisconnectionOID {
+		return nil
+	}
+	resultCode := n.ResultCode
+	if resultCode == LDAPResultSuccess {
+		resultCode = LDAPResultUnavailable
+	}
+	return NewError(resultCode, fmt.Errorf("ldap: notice of disconnection (%s)", n.Diagnostic))
+}
+
+// notify passes the notifications to the notification handler until the
+// connection is closed.
+func (l *Conn) notify(notifications <-chan *UnsolicitedNotification) {
+	for {
+		select {
+		case n := <-notifications:
+			l.notificationHandler(n)
+		case <-l.closed:
+			// Deliver what arrived before, e.g. the notice of disconnection
+			for {
+				select {
+				case n := <-notifications:
+					l.notificationHandler(n)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func decodeUnsolicitedNotification(packet *ber.Packet) (*UnsolicitedNotification, error) {
+	if len(packet.Children) < 2 {
+		return nil, errors.New("ldap: missing protocol operation")
+	}
+	response := packet.Children[1]
+	if response.ClassType != ber.ClassApplication || response.Tag != ApplicationExtendedResponse || len(response.Children) < 3 {
+		return nil, fmt.Errorf("ldap: unexpected response %d", response.Tag)
+	}
+
+	n := &UnsolicitedNotification{
+		MatchedDN:  ber.DecodeString(response.Children[1].Data.Bytes()),
+		Diagnostic: ber.DecodeString(response.Children[2].Data.Bytes()),
+		Controls:   decodePacketControls(packet),
+	}
+	resultCode, err := ber.ParseInt64(response.Children[0].Data.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	n.ResultCode = uint16(resultCode)
+	for _, child := range response.Children[3:] {
+		if child.ClassType != ber.ClassContext {
+			continue
+		}
+		switch child.Tag {
+		case 10:
+			n.ResponseName = ber.DecodeString(child.Data.Bytes())
+		case 11:
+			n.ResponseValue = child.Data.Bytes()
+		}
+	}
+	return n, nil
+}
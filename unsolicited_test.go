@@ -0,0 +1,120 @@
+package ldap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gopkg.in/asn1-ber.v1"
+)
+
+// newNotification encodes an unsolicited notification.
+func newNotification(resultCode int, diagnostic, name string) *ber.Packet {
+	response := newResult(ApplicationExtendedResponse, resultCode, diagnostic)
+	response.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 10, name, "Response Name"))
+	return response
+}
+
+func TestNoticeOfDisconnection(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	notifications := make(chan *UnsolicitedNotification, 1)
+	l := NewConn(client, false, DialWithNotificationHandler(func(n *UnsolicitedNotification) {
+		notifications <- n
+	}))
+	l.Start()
+	defer l.Close()
+	requests := readRequests(server)
+
+	done := make(chan error)
+	go func() {
+		_, err := l.Compare("cn=test,dc=example,dc=com", "cn", "test")
+		done <- err
+	}()
+	<-requests
+
+	writeResponse(t, server, 0, newNotification(LDAPResultUnavailable, "server shutting down", NoticeOfDisconnectionOID))
+
+	select {
+	case err := <-done:
+		if !IsErrorWithCode(err, LDAPResultUnavailable) {
+			t.Fatalf("expected the result code of the notice, got %v", err)
+		}
+		if err != l.Err() {
+			t.Errorf("expected the connection error %v, got %v", l.Err(), err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending request not failed after a notice of disconnection")
+	}
+
+	select {
+	case n := <-notifications:
+		if n.ResponseName != NoticeOfDisconnectionOID || n.Diagnostic != "server shutting down" {
+			t.Errorf("unexpected notification %+v", n)
+		}
+	case <-time.After(time.Second):
+		t.Error("handler not called for the notice of disconnection")
+	}
+	if !l.IsClosing() {
+		t.Error("connection not closing after a notice of disconnection")
+	}
+}
+
+func TestNotificationHandlerClose(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	closed := make(chan struct{})
+	var l *Conn
+	l = NewConn(client, false, DialWithNotificationHandler(func(n *UnsolicitedNotification) {
+		if n.ResponseName == NoticeOfDisconnectionOID {
+			l.Close()
+			close(closed)
+		}
+	}))
+	l.Start()
+	go func() {
+		for range readRequests(server) {
+		}
+	}()
+
+	writeResponse(t, server, 0, newNotification(LDAPResultUnavailable, "server shutting down", NoticeOfDisconnectionOID))
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close from the notification handler did not return")
+	}
+}
+
+func TestUnsolicitedNotification(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	notifications := make(chan *UnsolicitedNotification, 1)
+	l := NewConn(client, false, DialWithNotificationHandler(func(n *UnsolicitedNotification) {
+		notifications <- n
+	}))
+	l.Start()
+	defer l.Close()
+	requests := readRequests(server)
+
+	writeResponse(t, server, 0, newNotification(LDAPResultSuccess, "", "1.2.3.4"))
+	select {
+	case n := <-notifications:
+		if n.ResponseName != "1.2.3.4" || n.ResultCode != LDAPResultSuccess {
+			t.Errorf("unexpected notification %+v", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler not called")
+	}
+
+	// Other notifications leave the connection usable
+	done := make(chan error)
+	go func() {
+		_, err := l.Compare("cn=test,dc=example,dc=com", "cn", "test")
+		done <- err
+	}()
+	compareID := (<-requests).Children[0].Value.(int64)
+	writeResponse(t, server, compareID, newResult(ApplicationCompareResponse, LDAPResultCompareTrue, ""))
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,254 @@
+// File contains LDAP URL parsing functionality
+//
+// https://tools.ietf.org/html/rfc4516
+//
+//   ldapurl     = scheme COLON SLASH SLASH [host [COLON port]]
+//                    [SLASH dn [QUESTION [attributes]
+//                    [QUESTION [scope] [QUESTION [filter]
+//                    [QUESTION extensions]]]]]
+//   scheme      = "ldap"
+//   dn          = distinguishedName ; From Section 3 of [RFC4514],
+//                                   ; subject to the provisions of the
+//                                   ; "Percent-Encoding" section below.
+//   attributes  = attrdesc *(COMMA attrdesc)
+//   attrdesc    = selector *(COMMA selector)
+//   selector    = attributeSelector ; From Section 4.5.1 of [RFC4511],
+//                                   ; subject to the provisions of the
+//                                   ; "Percent-Encoding" section below.
+//   scope       = "base" / "one" / "sub"
+//   filter      = filter ; From Section 3 of [RFC4515],
+//                        ; subject to the provisions of the
+//                        ; "Percent-Encoding" section below.
+//   extensions  = extension *(COMMA extension)
+//   extension   = [EXCLAMATION] extype [EQUALS exvalue]
+//   extype      = oid ; From section 1.4 of [RFC4512].
+//   exvalue     = LDAPString ; From section 4.1.2 of [RFC4511],
+//                            ; subject to the provisions of the
+//                            ; "Percent-Encoding" section below.
+//
+// The ldaps:// and ldapi:// schemes are accepted as well. The host of an
+// ldapi:// URL is the percent-encoded path of a Unix socket.
+//
+
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// LDAPURL is an LDAP URL as defined in RFC 4516. All fields hold decoded
+// values.
+type LDAPURL struct {
+	// Scheme is "ldap", "ldaps" or "ldapi"
+	Scheme string
+	// Host is the host with an optional port, or the socket path for
+	// ldapi. It is empty if the client should use a default server.
+	Host string
+	// DN is the base DN of the search
+	DN string
+	// Attributes to return, all user attributes if empty
+	Attributes []string
+	// Scope is one of the Scope* constants, ScopeBaseObject by default
+	Scope int
+	// Filter of the search, (objectClass=*) if empty
+	Filter string
+	// Extensions of the URL
+	Extensions []LDAPURLExtension
+}
+
+// LDAPURLExtension is an extension of an LDAP URL, e.g. bindname. Clients
+// must not use a URL with a critical extension they do not implement.
+type LDAPURLExtension struct {
+	Critical bool
+	Type     string
+	Value    string
+}
+
+// ParseLDAPURL parses an LDAP URL.
+func ParseLDAPURL(rawURL string) (*LDAPURL, error) {
+	i := strings.Index(rawURL, "://")
+	if i < 0 {
+		return nil, fmt.Errorf("ldap: missing scheme in URL %q", rawURL)
+	}
+	u := &LDAPURL{Scheme: strings.ToLower(rawURL[:i])}
+	switch u.Scheme {
+	case "ldap", "ldaps", "ldapi":
+	default:
+		return nil, fmt.Errorf("ldap: unsupported URL scheme %q", u.Scheme)
+	}
+
+	rest := rawURL[i+3:]
+	host := rest
+	if j := strings.IndexByte(rest, '/'); j >= 0 {
+		host, rest = rest[:j], rest[j+1:]
+	} else {
+		rest = ""
+	}
+	if strings.ContainsAny(host, "?#") {
+		return nil, fmt.Errorf("ldap: invalid host in URL %q", rawURL)
+	}
+	var err error
+	if u.Host, err = url.PathUnescape(host); err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(rest, "?")
+	if len(parts) > 5 {
+		return nil, fmt.Errorf("ldap: too many components in URL %q", rawURL)
+	}
+	for len(parts) < 5 {
+		parts = append(parts, "")
+	}
+
+	if u.DN, err = url.PathUnescape(parts[0]); err != nil {
+		return nil, err
+	}
+
+	if parts[1] != "" {
+		for _, attr := range strings.Split(parts[1], ",") {
+			attr, err = url.PathUnescape(attr)
+			if err != nil {
+				return nil, err
+			}
+			u.Attributes = append(u.Attributes, attr)
+		}
+	}
+
+	switch strings.ToLower(parts[2]) {
+	case "", "base":
+		u.Scope = ScopeBaseObject
+	case "one":
+		u.Scope = ScopeSingleLevel
+	case "sub":
+		u.Scope = ScopeWholeSubtree
+	default:
+		return nil, fmt.Errorf("ldap: invalid scope %q in URL", parts[2])
+	}
+
+	if u.Filter, err = url.PathUnescape(parts[3]); err != nil {
+		return nil, err
+	}
+	if u.Filter != "" {
+		if _, err := CompileFilter(u.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	if parts[4] != "" {
+		for _, ext := range strings.Split(parts[4], ",") {
+			var e LDAPURLExtension
+			if strings.HasPrefix(ext, "!") {
+				e.Critical, ext = true, ext[1:]
+			}
+			value := ""
+			if j := strings.IndexByte(ext, '='); j >= 0 {
+				ext, value = ext[:j], ext[j+1:]
+			}
+			if e.Type, err = url.PathUnescape(ext); err != nil {
+				return nil, err
+			}
+			if e.Type == "" {
+				return nil, errors.New("ldap: empty extension type in URL")
+			}
+			if e.Value, err = url.PathUnescape(value); err != nil {
+				return nil, err
+			}
+			u.Extensions = append(u.Extensions, e)
+		}
+	}
+	return u, nil
+}
+
+// serverURL returns the URL of the server of u, with the default port and
+// a lowercase host, so that URLs naming the same server compare equal.
+func serverURL(u *LDAPURL) string {
+	host := u.Host
+	switch u.Scheme {
+	case "ldap":
+		host = strings.ToLower(withDefaultPort(host, DefaultLdapPort))
+	case "ldaps":
+		host = strings.ToLower(withDefaultPort(host, DefaultLdapsPort))
+	}
+	return (&LDAPURL{Scheme: u.Scheme, Host: host}).String()
+}
+
+// String returns the URL with the necessary characters percent-encoded.
+// Trailing empty components are left out.
+func (u *LDAPURL) String() string {
+	var parts []string
+	parts = append(parts, escapeURLComponent(u.DN, "?"))
+
+	attrs := make([]string, len(u.Attributes))
+	for i, attr := range u.Attributes {
+		attrs[i] = escapeURLComponent(attr, "?,")
+	}
+	parts = append(parts, strings.Join(attrs, ","))
+
+	switch u.Scope {
+	case ScopeSingleLevel:
+		parts = append(parts, "one")
+	case ScopeWholeSubtree:
+		parts = append(parts, "sub")
+	default:
+		parts = append(parts, "")
+	}
+
+	parts = append(parts, escapeURLComponent(u.Filter, "?"))
+
+	exts := make([]string, len(u.Extensions))
+	for i, e := range u.Extensions {
+		ext := escapeURLComponent(e.Type, "?,=!")
+		if e.Critical {
+			ext = "!" + ext
+		}
+		if e.Value != "" {
+			ext += "=" + escapeURLComponent(e.Value, "?,")
+		}
+		exts[i] = ext
+	}
+	parts = append(parts, strings.Join(exts, ","))
+
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+
+	host := u.Host
+	if u.Scheme == "ldapi" {
+		host = escapeURLComponent(host, "/?:")
+	} else {
+		host = escapeURLComponent(host, "/?")
+	}
+
+	s := u.Scheme + "://" + host
+	if len(parts) > 0 {
+		s += "/" + strings.Join(parts, "?")
+	}
+	return s
+}
+
+// SearchRequest returns a request for the search described by the URL.
+func (u *LDAPURL) SearchRequest(controls []Control) *SearchRequest {
+	filter := u.Filter
+	if filter == "" {
+		filter = "(objectClass=*)"
+	}
+	return NewSearchRequest(u.DN, u.Scope, NeverDerefAliases, 0, 0, false, filter, u.Attributes, controls)
+}
+
+// escapeURLComponent percent-encodes bytes that may not appear in a URL
+// and the given reserved characters.
+func escapeURLComponent(s, reserved string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"%#<>\^`+"`{|}", c) >= 0 || strings.IndexByte(reserved, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
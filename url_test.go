@@ -0,0 +1,92 @@
+package ldap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLDAPURL(t *testing.T) {
+	testcases := []struct {
+		raw      string
+		expected LDAPURL
+		str      string
+	}{
+		{"ldap://", LDAPURL{Scheme: "ldap"}, ""},
+		{"LDAP://ldap1.example.net", LDAPURL{Scheme: "ldap", Host: "ldap1.example.net"}, "ldap://ldap1.example.net"},
+		{"ldap://ldap1.example.net:6389/", LDAPURL{Scheme: "ldap", Host: "ldap1.example.net:6389"}, "ldap://ldap1.example.net:6389"},
+		{"ldap:///o=University%20of%20Michigan,c=US",
+			LDAPURL{Scheme: "ldap", DN: "o=University of Michigan,c=US"}, ""},
+		{"ldap://ldap1.example.net/o=University%20of%20Michigan,c=US?postalAddress",
+			LDAPURL{Scheme: "ldap", Host: "ldap1.example.net", DN: "o=University of Michigan,c=US", Attributes: []string{"postalAddress"}}, ""},
+		{"ldap://[2001:db8::7]/c=GB?objectClass?one",
+			LDAPURL{Scheme: "ldap", Host: "[2001:db8::7]", DN: "c=GB", Attributes: []string{"objectClass"}, Scope: ScopeSingleLevel}, ""},
+		{"ldaps://ldap.example.com/dc=example,dc=com?cn,mail?sub?(&(objectClass=person)(cn=J*))",
+			LDAPURL{Scheme: "ldaps", Host: "ldap.example.com", DN: "dc=example,dc=com", Attributes: []string{"cn", "mail"}, Scope: ScopeWholeSubtree,
+				Filter: "(&(objectClass=person)(cn=J*))"}, ""},
+		{"ldap://ldap.example.com/o=An%20Example%5C2C%20Inc.,c=US",
+			LDAPURL{Scheme: "ldap", Host: "ldap.example.com", DN: `o=An Example\2C Inc.,c=US`}, ""},
+		{"ldap:///??sub??e-bindname=cn=Manager%2cdc=example%2cdc=com",
+			LDAPURL{Scheme: "ldap", Scope: ScopeWholeSubtree, Extensions: []LDAPURLExtension{{Type: "e-bindname", Value: "cn=Manager,dc=example,dc=com"}}},
+			"ldap:///??sub??e-bindname=cn=Manager%2Cdc=example%2Cdc=com"},
+		{"ldap:///??sub??!e-bindname=cn=Manager%2cdc=example%2cdc=com,!StartTLS",
+			LDAPURL{Scheme: "ldap", Scope: ScopeWholeSubtree, Extensions: []LDAPURLExtension{
+				{Critical: true, Type: "e-bindname", Value: "cn=Manager,dc=example,dc=com"}, {Critical: true, Type: "StartTLS"}}},
+			"ldap:///??sub??!e-bindname=cn=Manager%2Cdc=example%2Cdc=com,!StartTLS"},
+		{"ldap://ldap.example.com/dc=example,dc=com??base?(cn=a%3fb)",
+			LDAPURL{Scheme: "ldap", Host: "ldap.example.com", DN: "dc=example,dc=com", Filter: "(cn=a?b)"},
+			"ldap://ldap.example.com/dc=example,dc=com???(cn=a%3Fb)"},
+		{"ldapi://%2Fvar%2Frun%2Fslapd%2Fldapi", LDAPURL{Scheme: "ldapi", Host: "/var/run/slapd/ldapi"}, "ldapi://%2Fvar%2Frun%2Fslapd%2Fldapi"},
+	}
+
+	for _, testcase := range testcases {
+		u, err := ParseLDAPURL(testcase.raw)
+		if err != nil {
+			t.Errorf("%s: %v", testcase.raw, err)
+			continue
+		}
+		if !reflect.DeepEqual(*u, testcase.expected) {
+			t.Errorf("%s: expected %+v, got %+v", testcase.raw, testcase.expected, *u)
+		}
+
+		expected := testcase.str
+		if expected == "" {
+			expected = testcase.raw
+		}
+		if u.String() != expected {
+			t.Errorf("%s: String returned %s", testcase.raw, u.String())
+		}
+
+		reparsed, err := ParseLDAPURL(u.String())
+		if err != nil || !reflect.DeepEqual(reparsed, u) {
+			t.Errorf("%s: %s does not parse to the same URL: %+v, %v", testcase.raw, u.String(), reparsed, err)
+		}
+	}
+}
+
+func TestParseLDAPURLErrors(t *testing.T) {
+	for _, raw := range []string{
+		"ldap.example.com",
+		"http://ldap.example.com/",
+		"ldap://ldap.example.com?cn",
+		"ldap://ldap.example.com/dc=example??subtree",
+		"ldap://ldap.example.com/dc=example???(cn=a",
+		"ldap://ldap.example.com/dc=example????,",
+		"ldap://ldap.example.com/dc=example?????",
+		"ldap://ldap.example.com/dc=%zz",
+	} {
+		if _, err := ParseLDAPURL(raw); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
+
+func TestLDAPURLSearchRequest(t *testing.T) {
+	u, err := ParseLDAPURL("ldap://ldap.example.com/dc=example,dc=com?cn?one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := u.SearchRequest(nil)
+	if req.BaseDN != "dc=example,dc=com" || req.Scope != ScopeSingleLevel || req.Filter != "(objectClass=*)" || !reflect.DeepEqual(req.Attributes, []string{"cn"}) {
+		t.Errorf("unexpected request %+v", req)
+	}
+}